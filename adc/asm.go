@@ -3,13 +3,79 @@ package adc
 import (
 	"bufio"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
 )
 
-// parse a trace(disasm) log of FB V2.1A CMT save.
+// FBProfile is the timing of the CMT save routine:
+// the number of DEC iterations while the port $4016 is high.
+// The counts of 0 are calibrated by the leader (zeros).
+type FBProfile struct {
+	Name      string
+	Zero      int
+	One       int
+	Tolerance int
+}
+
+// built-in profiles of FB cartridges
+//
+// V2.1A is measured by the trace logs of its save routine: DEC $1C at $B59C.
+// Its tolerance is an arbitrary slack, far less than the half of the gap between Zero and One (27).
+// Use auto or FB2bin -zero, -one and -tolerance for the other versions.
+var FBProfiles = map[string]FBProfile{
+	"V2.1A": {"V2.1A", 52, 106, 3},
+	"auto":  {"auto", 0, 0, 0},
+}
+
+// ErrInvalidCount is a count of DEC iterations out of the profile.
+var ErrInvalidCount = errors.New("invalid count")
+
+// Validate checks the counts: the ranges of Zero and One must not overlap.
+func (p *FBProfile) Validate() error {
+	if p.Zero == 0 && p.One == 0 {
+		// auto
+		return nil
+	}
+	if p.Zero <= 0 || p.One <= 0 || p.Tolerance < 0 {
+		return fmt.Errorf("invalid profile %s: zero=%d, one=%d, tolerance=%d", p.Name, p.Zero, p.One, p.Tolerance)
+	}
+	if p.Zero+p.Tolerance >= p.One-p.Tolerance {
+		return fmt.Errorf("invalid profile %s: zero=%d and one=%d overlap by tolerance=%d", p.Name, p.Zero, p.One, p.Tolerance)
+	}
+	return nil
+}
+
+// calibrate sets the counts by a zero of the leader.
+// One is twice as long as Zero on tape (960 Hz and 1920 Hz), the counts are split at the midpoint.
+func (p *FBProfile) calibrate(zero int) error {
+	p.Zero = zero
+	p.One = zero * 2
+	p.Tolerance = zero/2 - 1
+	err := p.Validate()
+	if err != nil {
+		return fmt.Errorf("%w: leader %d", ErrInvalidCount, zero)
+	}
+	return nil
+}
+
+// bit returns the bit of the count.
+func (p *FBProfile) bit(count int) (byte, error) {
+	if p.Zero-p.Tolerance <= count && count <= p.Zero+p.Tolerance {
+		return 0, nil
+	}
+	if p.One-p.Tolerance <= count && count <= p.One+p.Tolerance {
+		return 1, nil
+	}
+	return 0, fmt.Errorf("%w: %d for %s", ErrInvalidCount, count, p.Name)
+}
+
+// parse a trace(disasm) log of FB CMT save.
 // You can use the trace log files instead of the real WAV files.
+// The logs of Mesen, Mesen2 and FCEUX are detected automatically.
+// A count out of the profile closes wbits with ErrInvalidCount.
 //
 // sample: watching for the port $4016 by Mesen emu
 //
@@ -18,69 +84,78 @@ import (
 //	B59C $C6 $1C     DEC $001C = $34
 //	B59E $D0 $FC     BNE $B59C = $C6
 //	...
-func FBPort2bits(wbits io.WriteCloser, f *os.File) {
+func FBPort2bits(wbits *io.PipeWriter, f *os.File, profile FBProfile) error {
+	err := profile.Validate()
+	if err != nil {
+		return err
+	}
+
 	go func() {
-		defer wbits.Close()
+		var bit [1]byte
+		write := func(count int, lineNo int) error {
+			if profile.Zero == 0 {
+				// auto: the 1st count is a zero of the leader
+				err := profile.calibrate(count)
+				if err != nil {
+					return fmt.Errorf("line %d: %w", lineNo, err)
+				}
+				fmt.Fprintf(os.Stderr, "profile: zero=%d, one=%d, tolerance=%d\n", profile.Zero, profile.One, profile.Tolerance)
+			}
+
+			b, err := profile.bit(count)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", lineNo, err)
+			}
+			bit[0] = b
+			_, err = wbits.Write(bit[:])
+			return err
+		}
 
 		scanner := bufio.NewScanner(f)
+		parser := &traceParser{}
 		zeroOrOne := -1
 		count := -1
-		var bit [1]byte
+		lineNo := 0
 		for scanner.Scan() {
-			l := scanner.Text()
-			if strings.Contains(l, "LDA") {
+			t, ok := parser.parse(scanner.Text())
+			lineNo++
+			if !ok {
+				continue
+			}
+			if t.Op == "LDA" {
 				if zeroOrOne == 1 {
-					if count == 52 {
-						bit[0] = 0
-						_, err := wbits.Write(bit[:])
-						if err != nil {
-							panic(err)
-						}
-					} else if count == 106 {
-						bit[0] = 1
-						_, err := wbits.Write(bit[:])
-						if err != nil {
-							panic(err)
-						}
-					} else {
-						panic(errors.New("invalid trace log"))
+					err := write(count, lineNo)
+					if err != nil {
+						wbits.CloseWithError(err)
+						return
 					}
 				}
-				if strings.Contains(l, "#$04") {
+				if t.Operand == "#$04" {
 					zeroOrOne = 0
 					count = 0
 				}
-				if strings.Contains(l, "#$FF") {
+				if t.Operand == "#$FF" {
 					zeroOrOne = 1
 					count = 0
 				}
 			}
-			if strings.Contains(l, "DEC") {
+			if t.Op == "DEC" {
 				count += 1
 			}
 		}
-		if zeroOrOne == 1 {
-			if count == 52 {
-				bit[0] = 0
-				_, err := wbits.Write(bit[:])
-				if err != nil {
-					panic(err)
-				}
-			} else if count == 106 {
-				bit[0] = 1
-				_, err := wbits.Write(bit[:])
-				if err != nil {
-					panic(err)
-				}
-			} else {
-				panic(errors.New("invalid trace log"))
-			}
+		err := scanner.Err()
+		if err == nil && zeroOrOne == 1 {
+			err = write(count, lineNo)
 		}
+		fmt.Fprintf(os.Stderr, "trace log: %s\n", parser.format)
+		wbits.CloseWithError(err)
 	}()
+	return nil
 }
 
 // parse a trace(disasm) log of FB V2.1A CMT save.
 // You can use the trace log files instead of the real WAV files.
+// The logs of Mesen, Mesen2 and FCEUX are detected automatically.
 //
 // sample: watching for the executions $B591 and $B587 by Mesen emu
 //
@@ -97,11 +172,15 @@ func FBAsm2bits(wbits io.WriteCloser, f *os.File) {
 		defer wbits.Close()
 
 		scanner := bufio.NewScanner(f)
+		parser := &traceParser{}
 		var bit [1]byte
 		for scanner.Scan() {
-			l := scanner.Text()
+			t, ok := parser.parse(scanner.Text())
+			if !ok || t.Op != "LDA" {
+				continue
+			}
 			// Zero
-			if strings.Contains(l, "#$34") {
+			if t.Operand == "#$34" {
 				bit[0] = 0
 				_, err := wbits.Write(bit[:])
 				if err != nil {
@@ -109,7 +188,7 @@ func FBAsm2bits(wbits io.WriteCloser, f *os.File) {
 				}
 			}
 			// One
-			if strings.Contains(l, "#$6A") {
+			if t.Operand == "#$6A" {
 				bit[0] = 1
 				_, err := wbits.Write(bit[:])
 				if err != nil {
@@ -117,5 +196,51 @@ func FBAsm2bits(wbits io.WriteCloser, f *os.File) {
 				}
 			}
 		}
+		fmt.Fprintf(os.Stderr, "trace log: %s\n", parser.format)
+	}()
+}
+
+// PortWrite is a write to the port $4016.
+type PortWrite struct {
+	Cycle int64 // CPU cycles
+	Value byte
+}
+
+// parse a trace(disasm) log of FB CMT save with the CPU cycle counts.
+// The value of A is tracked by LDA #imm.
+//
+// sample: watching for the port $4016 by Mesen2 emu
+//
+//	B597  LDA #$04          A:04 X:00 Y:00 S:FD P:nvUbdIzc V:241 H:123 Fr:10 Cycle:1448931
+//	B599  STA $4016 = $00   A:04 X:00 Y:00 S:FD P:nvUbdIzc V:241 H:132 Fr:10 Cycle:1448934
+//	...
+func FBPort2writes(writes chan<- PortWrite, f *os.File) {
+	go func() {
+		defer close(writes)
+
+		scanner := bufio.NewScanner(f)
+		parser := &traceParser{}
+		a := byte(0)
+		lineNo := 0
+		for scanner.Scan() {
+			t, ok := parser.parse(scanner.Text())
+			lineNo++
+			if !ok {
+				continue
+			}
+			if t.Op == "LDA" && strings.HasPrefix(t.Operand, "#$") {
+				v, err := strconv.ParseUint(t.Operand[2:], 16, 8)
+				if err == nil {
+					a = byte(v)
+				}
+			}
+			if t.Op == "STA" && t.Operand == "$4016" {
+				if t.Cycle < 0 {
+					panic(fmt.Errorf("invalid trace log: line %d: no cycle count", lineNo))
+				}
+				writes <- PortWrite{Cycle: t.Cycle, Value: a}
+			}
+		}
+		fmt.Fprintf(os.Stderr, "trace log: %s\n", parser.format)
 	}()
 }
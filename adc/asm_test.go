@@ -0,0 +1,109 @@
+package adc
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFBProfileValidate(t *testing.T) {
+	for name, p := range FBProfiles {
+		if err := p.Validate(); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	for _, p := range []FBProfile{
+		{"zero", 0, 106, 3},
+		{"one", 52, 0, 3},
+		{"negative", -52, 106, 3},
+		{"tolerance", 52, 106, -1},
+		{"order", 106, 52, 3},
+		{"overlap", 52, 60, 4},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: no error", p.Name)
+		}
+	}
+}
+
+func TestFBProfileCalibrate(t *testing.T) {
+	p := FBProfiles["auto"]
+	if err := p.calibrate(52); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		count int
+		bit   byte
+		ok    bool
+	}{{26, 0, false}, {27, 0, true}, {52, 0, true}, {77, 0, true}, {78, 0, false}, {79, 1, true}, {106, 1, true}, {129, 1, true}, {130, 0, false}} {
+		b, err := p.bit(tt.count)
+		if (err == nil) != tt.ok || b != tt.bit {
+			t.Errorf("%d: got %d, %v", tt.count, b, err)
+		}
+	}
+
+	p = FBProfiles["auto"]
+	if err := p.calibrate(1); !errors.Is(err, ErrInvalidCount) {
+		t.Errorf("leader 1: %v", err)
+	}
+}
+
+// fbTrace writes a Mesen trace log of the counts.
+func fbTrace(t *testing.T, counts ...int) *os.File {
+	var sb strings.Builder
+	for _, c := range counts {
+		sb.WriteString("B597 $A9 $04     LDA #$04\n")
+		sb.WriteString("B599 $8D $16 $40 STA $4016 = $00\n")
+		sb.WriteString("B597 $A9 $FF     LDA #$FF\n")
+		sb.WriteString("B599 $8D $16 $40 STA $4016 = $00\n")
+		for i := 0; i < c; i++ {
+			sb.WriteString("B59C $C6 $1C     DEC $001C = $34\n")
+			sb.WriteString("B59E $D0 $FC     BNE $B59C = $C6\n")
+		}
+	}
+	name := filepath.Join(t.TempDir(), "trace.log")
+	if err := os.WriteFile(name, []byte(sb.String()), 0666); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func TestFBPort2bits(t *testing.T) {
+	for _, name := range []string{"V2.1A", "auto"} {
+		rbits, wbits := io.Pipe()
+		if err := FBPort2bits(wbits, fbTrace(t, 52, 52, 106, 51, 107), FBProfiles[name]); err != nil {
+			t.Fatal(err)
+		}
+		bits, err := io.ReadAll(rbits)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(bits) != "\x00\x00\x01\x00\x01" {
+			t.Errorf("%s: got %v", name, bits)
+		}
+	}
+
+	// a count out of the profile is an error, not a panic
+	rbits, wbits := io.Pipe()
+	if err := FBPort2bits(wbits, fbTrace(t, 52, 80, 52), FBProfiles["V2.1A"]); err != nil {
+		t.Fatal(err)
+	}
+	bits, err := io.ReadAll(rbits)
+	if !errors.Is(err, ErrInvalidCount) || len(bits) != 1 {
+		t.Errorf("got %v, %v", bits, err)
+	}
+
+	if err := FBPort2bits(wbits, nil, FBProfile{"bad", 52, 0, 3}); err == nil {
+		t.Errorf("bad profile: no error")
+	}
+}
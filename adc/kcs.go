@@ -0,0 +1,185 @@
+package adc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sort"
+	"sync"
+)
+
+// causes of the demodulation errors
+var (
+	ErrLoneHalfCycle    = errors.New("lone half cycle of One")
+	ErrInvalidHalfCycle = errors.New("invalid half cycle")
+)
+
+// KCSEvent is an out-of-band event of the KCS demodulation.
+type KCSEvent struct {
+	Bit    int64 // position in the bit stream, the event is before the bit
+	Sample int64 // position in the wav, -1 if unknown
+	Baud   int   // baud rate detected by the leader
+	Err    error // demodulation error, the bits around it are not reliable
+}
+
+// KCSLog is the events of the demodulation.
+// It can be read while demodulating: the events are logged before the following bits are written.
+// The events are in the order of the bits.
+type KCSLog struct {
+	mu    sync.Mutex
+	bauds []KCSEvent
+	errs  []KCSEvent
+}
+
+func (l *KCSLog) add(e KCSEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e.Baud != 0 {
+		l.bauds = append(l.bauds, e)
+	}
+	if e.Err != nil {
+		l.errs = append(l.errs, e)
+	}
+}
+
+// Baud returns the baud rate at the bit, 0 if no leader is detected yet.
+func (l *KCSLog) Baud(bit int64) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	i := sort.Search(len(l.bauds), func(i int) bool { return l.bauds[i].Bit > bit })
+	if i == 0 {
+		return 0
+	}
+	return l.bauds[i-1].Baud
+}
+
+// Errors returns the demodulation errors in the bits [from, to).
+func (l *KCSLog) Errors(from, to int64) []KCSEvent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lo := sort.Search(len(l.errs), func(i int) bool { return l.errs[i].Bit >= from })
+	hi := sort.Search(len(l.errs), func(i int) bool { return l.errs[i].Bit >= to })
+	if lo >= hi {
+		return nil
+	}
+	return append([]KCSEvent(nil), l.errs[lo:hi]...)
+}
+
+// BitCounter counts the bits read, to look up the events by the position.
+// The bits can be pushed back to resync.
+type BitCounter struct {
+	r       io.Reader
+	pos     int64
+	pending []byte
+}
+
+// NewBitCounter returns a BitCounter.
+func NewBitCounter(r io.Reader) *BitCounter {
+	return &BitCounter{r: r}
+}
+
+func (c *BitCounter) Read(p []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		c.pos += int64(n)
+		return n, nil
+	}
+	n, err := c.r.Read(p)
+	c.pos += int64(n)
+	return n, err
+}
+
+// Unread pushes back the bits, they are read again.
+func (c *BitCounter) Unread(bits []byte) {
+	c.pending = append(append([]byte(nil), bits...), c.pending...)
+	c.pos -= int64(len(bits))
+}
+
+// Pos returns the position of the next bit.
+func (c *BitCounter) Pos() int64 {
+	return c.pos
+}
+
+// KCSFrame decodes a byte: start bit(0) + 8 bits from LSB + stop bits(1, ...).
+// ok is false if the start bit or the stop bits are broken, the data bits are decoded anyway.
+func KCSFrame(bits []byte) (b byte, ok bool) {
+	for i := 0; i < 8; i++ {
+		b |= (bits[1+i] & 1) << i
+	}
+	ok = bits[0] == 0
+	for _, s := range bits[9:] {
+		ok = ok && s == 1
+	}
+	return b, ok
+}
+
+// frames checked ahead to resync
+const resyncFrames = 3
+
+// ErrEndOfBlock is returned by KCSResync if no valid frame follows.
+var ErrEndOfBlock = errors.New("end of block")
+
+// KCSResync reads the next frame into bits after the broken frame in bits.
+// Bits may be lost or added by the demodulation errors:
+// the next frame starts at the nearest position where the following frames are valid (or all ones: the end of the block).
+// The position is searched around the next frame if the broken one has the start bit (the byte is kept),
+// or around the broken one if not (the byte is re-framed).
+// If there is no valid frame, it's the end of the block: the bits are pushed back and ErrEndOfBlock is returned.
+func KCSResync(c *BitCounter, bits []byte) error {
+	n := len(bits)
+	ahead := make([]byte, resyncFrames*n+1)
+	m, err := io.ReadFull(c, ahead)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return err
+	}
+	s := append(append([]byte(nil), bits[1:]...), ahead[0:m]...)
+
+	valid := func(f []byte) bool {
+		_, ok := KCSFrame(f)
+		return ok || bytes.Count(f, []byte{1}) == len(f)
+	}
+	score := func(off int) int {
+		k := 0
+		for ; off+n <= len(s) && valid(s[off:off+n]); off += n {
+			k++
+		}
+		return k
+	}
+
+	// the next frame, or the broken frame itself without the start bit
+	center := n - 1
+	if bits[0] != 0 {
+		center = 0
+	}
+	best, bestScore := center, -1
+	for d := 0; d < n; d++ {
+		for _, off := range []int{center - d, center + d} {
+			if off < 0 || off > len(s) {
+				continue
+			}
+			if k := score(off); k > bestScore {
+				best, bestScore = off, k
+			}
+		}
+	}
+	if bestScore == 0 {
+		c.Unread(ahead[0:m])
+		return ErrEndOfBlock
+	}
+	c.Unread(s[best:])
+
+	_, err = io.ReadFull(c, bits)
+	return err
+}
+
+// leader detection: a run of the same half cycles
+const leaderHalfCycles = 64
+
+// baudOfLeader returns the baud rate by the frequency of the leader: 2400 Hz or 4800 Hz.
+func baudOfLeader(hz float64) int {
+	if hz < 3600 {
+		return 1200
+	}
+	return 2400
+}
@@ -0,0 +1,85 @@
+package adc
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestKCSLog(t *testing.T) {
+	l := &KCSLog{}
+	l.add(KCSEvent{Bit: 10, Baud: 1200})
+	l.add(KCSEvent{Bit: 20, Err: ErrLoneHalfCycle})
+	l.add(KCSEvent{Bit: 30, Baud: 2400})
+	l.add(KCSEvent{Bit: 30, Err: ErrInvalidHalfCycle})
+
+	for _, tt := range []struct {
+		bit  int64
+		baud int
+	}{{0, 0}, {10, 1200}, {29, 1200}, {30, 2400}, {100, 2400}} {
+		if got := l.Baud(tt.bit); got != tt.baud {
+			t.Errorf("Baud(%d): %d, want %d", tt.bit, got, tt.baud)
+		}
+	}
+	for _, tt := range []struct {
+		from, to int64
+		n        int
+	}{{0, 20, 0}, {20, 21, 1}, {20, 31, 2}, {31, 100, 0}} {
+		if got := l.Errors(tt.from, tt.to); len(got) != tt.n {
+			t.Errorf("Errors(%d, %d): %v", tt.from, tt.to, got)
+		}
+	}
+}
+
+func frameBits(data ...byte) []byte {
+	var bits []byte
+	for _, b := range data {
+		bits = append(bits, 0)
+		for i := 0; i < 8; i++ {
+			bits = append(bits, (b>>i)&1)
+		}
+		bits = append(bits, 1, 1)
+	}
+	return bits
+}
+
+func TestKCSResync(t *testing.T) {
+	ones := bytes.Repeat([]byte{1}, 22)
+
+	// the 2nd bit of 0x5a is lost: the stop bits are broken
+	stream := frameBits(0x5a, 0x12, 0x34, 0x56)
+	stream = append(append(stream[0:2:2], stream[3:]...), ones...)
+	c := NewBitCounter(bytes.NewReader(stream))
+	bits := make([]byte, 11)
+	io.ReadFull(c, bits)
+	if _, ok := KCSFrame(bits); ok {
+		t.Fatalf("frame is valid: %v", bits)
+	}
+	if err := KCSResync(c, bits); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := KCSFrame(bits); !ok || b != 0x12 {
+		t.Errorf("next: %02x, %v", b, ok)
+	}
+	if c.Pos() != 2*11-1 {
+		t.Errorf("pos: %d", c.Pos())
+	}
+
+	// a One is added before the start bit: re-framed
+	stream = append([]byte{1}, frameBits(0x12, 0x34, 0x56)...)
+	c = NewBitCounter(bytes.NewReader(append(stream, ones...)))
+	io.ReadFull(c, bits)
+	if err := KCSResync(c, bits); err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := KCSFrame(bits); !ok || b != 0x12 {
+		t.Errorf("re-framed: %02x, %v", b, ok)
+	}
+
+	// no valid frame
+	c = NewBitCounter(bytes.NewReader(make([]byte, 50)))
+	io.ReadFull(c, bits)
+	if err := KCSResync(c, bits); err != ErrEndOfBlock {
+		t.Errorf("end of block: %v", err)
+	}
+}
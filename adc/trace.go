@@ -0,0 +1,157 @@
+package adc
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// TraceFormat is the flavour of the trace log.
+type TraceFormat int
+
+const (
+	TraceUnknown TraceFormat = iota
+	TraceMesen
+	TraceMesen2
+	TraceFCEUX
+)
+
+func (f TraceFormat) String() string {
+	switch f {
+	case TraceMesen:
+		return "Mesen"
+	case TraceMesen2:
+		return "Mesen2"
+	case TraceFCEUX:
+		return "FCEUX"
+	}
+	return "unknown"
+}
+
+// TraceLine is an instruction in the trace log.
+type TraceLine struct {
+	PC      uint16
+	Op      string // mnemonic: LDA, STA, ...
+	Operand string // #$04, $4016, ...
+	Cycle   int64  // CPU cycle count, -1 if not logged
+}
+
+// 6502 mnemonics
+var mnemonics = func() map[string]bool {
+	m := make(map[string]bool)
+	for _, op := range strings.Fields(`
+		ADC AND ASL BCC BCS BEQ BIT BMI BNE BPL BRK BVC BVS CLC CLD CLI CLV CMP CPX CPY
+		DEC DEX DEY EOR INC INX INY JMP JSR LDA LDX LDY LSR NOP ORA PHA PHP PLA PLP
+		ROL ROR RTI RTS SBC SEC SED SEI STA STX STY TAX TAY TSX TXA TXS TYA`) {
+		m[op] = true
+	}
+	return m
+}()
+
+var (
+	// FCEUX:
+	//	f1      c7          i0          A:00 X:00 Y:00 S:FD P:nvubdIzc  $C000:4C F5 C5  JMP $C5F5
+	//	$B597:A9 04     LDA #$04                        A:00 X:00 Y:00 S:FD P:nvUbdIzc
+	reFCEUXPC    = regexp.MustCompile(`\$([0-9A-Fa-f]{4}):`)
+	reFCEUXCycle = regexp.MustCompile(`(?:^|\s)c(\d+)(?:\s|$)`)
+
+	// Mesen:
+	//	B597 $A9 $04     LDA #$04                 A:00 X:00 Y:00 P:24 SP:FD CYC:123 SL:241 CPU Cycle:123456
+	//	B587 LDA #$34
+	reMesenCycle = regexp.MustCompile(`CPU Cycle:(\d+)`)
+
+	// Mesen2:
+	//	B597  LDA #$04                 A:00 X:00 Y:00 S:FD P:nvUbdIzc V:241 H:123 Fr:10 Cycle:123456
+	reMesen2Flags = regexp.MustCompile(`P:[NnVv-][VvUu-]`)
+	reMesen2Cycle = regexp.MustCompile(`(?:^|\s)Cycle:(\d+)`)
+
+	rePC = regexp.MustCompile(`^\s*([0-9A-Fa-f]{4})\s`)
+)
+
+// DetectTraceFormat guesses the flavour by a line of the trace log.
+func DetectTraceFormat(l string) TraceFormat {
+	if reFCEUXPC.MatchString(l) {
+		return TraceFCEUX
+	}
+	if !rePC.MatchString(l) {
+		return TraceUnknown
+	}
+	if reMesenCycle.MatchString(l) || strings.Contains(l, "CYC:") {
+		return TraceMesen
+	}
+	if reMesen2Flags.MatchString(l) || reMesen2Cycle.MatchString(l) || strings.Contains(l, "Fr:") {
+		return TraceMesen2
+	}
+	// Mesen2 aligns the disassembly with 2 spaces after PC
+	if len(l) > 5 && l[4] == ' ' && l[5] == ' ' {
+		return TraceMesen2
+	}
+	return TraceMesen
+}
+
+// ParseTraceLine parses a line of the trace log.
+func ParseTraceLine(format TraceFormat, l string) (TraceLine, bool) {
+	t := TraceLine{Cycle: -1}
+
+	// PC
+	var rest string
+	switch format {
+	case TraceFCEUX:
+		m := reFCEUXPC.FindStringSubmatchIndex(l)
+		if m == nil {
+			return t, false
+		}
+		pc, _ := strconv.ParseUint(l[m[2]:m[3]], 16, 16)
+		t.PC = uint16(pc)
+		rest = l[m[1]:]
+		if c := reFCEUXCycle.FindStringSubmatch(l[0:m[0]]); c != nil {
+			t.Cycle, _ = strconv.ParseInt(c[1], 10, 64)
+		}
+	case TraceMesen, TraceMesen2:
+		m := rePC.FindStringSubmatchIndex(l)
+		if m == nil {
+			return t, false
+		}
+		pc, _ := strconv.ParseUint(l[m[2]:m[3]], 16, 16)
+		t.PC = uint16(pc)
+		rest = l[m[1]:]
+		re := reMesenCycle
+		if format == TraceMesen2 {
+			re = reMesen2Cycle
+		}
+		if c := re.FindStringSubmatch(l); c != nil {
+			t.Cycle, _ = strconv.ParseInt(c[1], 10, 64)
+		}
+	default:
+		return t, false
+	}
+
+	// opcode & operand: skip the bytes of the instruction
+	fields := strings.Fields(rest)
+	for i, f := range fields {
+		op := strings.ToUpper(f)
+		if mnemonics[op] {
+			t.Op = op
+			if i+1 < len(fields) && !strings.Contains(fields[i+1], ":") {
+				t.Operand = strings.ToUpper(fields[i+1])
+			}
+			return t, true
+		}
+	}
+	return t, false
+}
+
+// traceParser detects the format by the first valid line.
+type traceParser struct {
+	format TraceFormat
+}
+
+func (p *traceParser) parse(l string) (TraceLine, bool) {
+	if p.format == TraceUnknown {
+		p.format = DetectTraceFormat(l)
+		if p.format == TraceUnknown {
+			return TraceLine{}, false
+		}
+	}
+	return ParseTraceLine(p.format, l)
+}
@@ -0,0 +1,80 @@
+package adc
+
+import "testing"
+
+func TestTrace(t *testing.T) {
+	tests := []struct {
+		format TraceFormat
+		line   string
+		want   TraceLine
+	}{
+		// FCEUX
+		{TraceFCEUX, "f1      c7          i0          A:00 X:00 Y:00 S:FD P:nvubdIzc  $C000:4C F5 C5  JMP $C5F5", TraceLine{0xc000, "JMP", "$C5F5", 7}},
+		{TraceFCEUX, "$B597:A9 04     LDA #$04                        A:00 X:00 Y:00 S:FD P:nvUbdIzc", TraceLine{0xb597, "LDA", "#$04", -1}},
+		{TraceFCEUX, "f10     c1448934    i482978     A:04 X:00 Y:00 S:FD P:nvUbdIzc  $B599:8D 16 40  STA $4016 = #$00", TraceLine{0xb599, "STA", "$4016", 1448934}},
+
+		// Mesen
+		{TraceMesen, "B597 $A9 $04     LDA #$04                 A:00 X:00 Y:00 P:24 SP:FD CYC:123 SL:241 CPU Cycle:123456", TraceLine{0xb597, "LDA", "#$04", 123456}},
+		{TraceMesen, "B587 LDA #$34", TraceLine{0xb587, "LDA", "#$34", -1}},
+		{TraceMesen, "B59C $C6 $1C     DEC $001C = $34", TraceLine{0xb59c, "DEC", "$001C", -1}},
+		{TraceMesen, "B59E $D0 $FC     BNE $B59C = $C6", TraceLine{0xb59e, "BNE", "$B59C", -1}},
+
+		// Mesen2
+		{TraceMesen2, "B597  LDA #$04                 A:00 X:00 Y:00 S:FD P:nvUbdIzc V:241 H:123 Fr:10 Cycle:123456", TraceLine{0xb597, "LDA", "#$04", 123456}},
+		{TraceMesen2, "B599  STA $4016 = $00   A:04 X:00 Y:00 S:FD P:nvUbdIzc V:241 H:132 Fr:10 Cycle:1448934", TraceLine{0xb599, "STA", "$4016", 1448934}},
+		{TraceMesen2, "C5F5  rts                      A:00 X:00 Y:00 S:FD P:nvUbdIzc V:0 H:0 Fr:1 Cycle:8", TraceLine{0xc5f5, "RTS", "", 8}},
+	}
+	for _, tt := range tests {
+		if got := DetectTraceFormat(tt.line); got != tt.format {
+			t.Errorf("%q: format %v, want %v", tt.line, got, tt.format)
+		}
+		got, ok := ParseTraceLine(tt.format, tt.line)
+		if !ok {
+			t.Errorf("%q: no match", tt.line)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: got %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestTraceNoMatch(t *testing.T) {
+	for _, l := range []string{"", "Log started", "-- frame 10 --", "FFFF"} {
+		if f := DetectTraceFormat(l); f != TraceUnknown {
+			t.Errorf("%q: format %v", l, f)
+		}
+	}
+
+	tests := []struct {
+		format TraceFormat
+		line   string
+	}{
+		{TraceUnknown, "B587 LDA #$34"},
+		{TraceFCEUX, "B587 LDA #$34"},
+		{TraceMesen, "Log started"},
+		{TraceMesen, "B597 $A9 $04"},
+		{TraceMesen2, "$B597:A9 04"},
+	}
+	for _, tt := range tests {
+		if got, ok := ParseTraceLine(tt.format, tt.line); ok {
+			t.Errorf("%v %q: got %+v", tt.format, tt.line, got)
+		}
+	}
+}
+
+func TestTraceParser(t *testing.T) {
+	p := &traceParser{}
+	if _, ok := p.parse("Log started"); ok || p.format != TraceUnknown {
+		t.Errorf("header: %v", p.format)
+	}
+	got, ok := p.parse("B597  LDA #$04                 A:00 X:00 Y:00 S:FD P:nvUbdIzc V:241 H:123 Fr:10 Cycle:123456")
+	if !ok || p.format != TraceMesen2 || got.Op != "LDA" {
+		t.Errorf("1st line: %v %+v", p.format, got)
+	}
+	// the format is kept
+	got, ok = p.parse("B599  STA $4016")
+	if !ok || p.format != TraceMesen2 || got.Cycle != -1 {
+		t.Errorf("2nd line: %v %+v", p.format, got)
+	}
+}
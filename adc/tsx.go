@@ -0,0 +1,193 @@
+package adc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// T-states of ZX Spectrum
+const tsxClock = 3500000
+
+// lengths of the TZX blocks to skip: fixed part and the position/size of the length field
+var tzxBlocks = map[byte]struct {
+	fixed   int
+	lenPos  int
+	lenSize int
+	lenMul  int
+}{
+	0x10: {0x04, 0x02, 2, 1}, // standard speed data
+	0x11: {0x12, 0x0f, 3, 1}, // turbo speed data
+	0x12: {0x04, 0, 0, 0},    // pure tone
+	0x13: {0x01, 0x00, 1, 2}, // pulse sequence
+	0x14: {0x0a, 0x07, 3, 1}, // pure data
+	0x15: {0x08, 0x05, 3, 1}, // direct recording
+	0x18: {0x04, 0x00, 4, 1}, // CSW recording
+	0x19: {0x04, 0x00, 4, 1}, // generalized data
+	0x20: {0x02, 0, 0, 0},    // pause
+	0x21: {0x01, 0x00, 1, 1}, // group start
+	0x22: {0x00, 0, 0, 0},    // group end
+	0x23: {0x02, 0, 0, 0},    // jump to block
+	0x24: {0x02, 0, 0, 0},    // loop start
+	0x25: {0x00, 0, 0, 0},    // loop end
+	0x26: {0x02, 0x00, 2, 2}, // call sequence
+	0x27: {0x00, 0, 0, 0},    // return from sequence
+	0x28: {0x02, 0x00, 2, 1}, // select block
+	0x2a: {0x04, 0, 0, 0},    // stop the tape if in 48K mode
+	0x2b: {0x05, 0, 0, 0},    // set signal level
+	0x30: {0x01, 0x00, 1, 1}, // text description
+	0x31: {0x02, 0x01, 1, 1}, // message
+	0x32: {0x02, 0x00, 2, 1}, // archive info
+	0x33: {0x01, 0x00, 1, 3}, // hardware type
+	0x35: {0x14, 0x10, 4, 1}, // custom info
+	0x5a: {0x09, 0, 0, 0},    // glue
+}
+
+// UnsupportedBlockError is the ID of a TSX block which can't be skipped: the length is unknown.
+type UnsupportedBlockError byte
+
+func (e UnsupportedBlockError) Error() string {
+	return fmt.Sprintf("unsupported TSX block: %02x", byte(e))
+}
+
+// skipTZXBlock skips the body of a block.
+// The jumps, the calls and the loops are not followed: the blocks are read in the order of the file.
+func skipTZXBlock(f io.Reader, id byte) error {
+	b, ok := tzxBlocks[id]
+	if !ok {
+		return UnsupportedBlockError(id)
+	}
+	fixed := make([]byte, b.fixed)
+	_, err := io.ReadFull(f, fixed)
+	if err != nil {
+		return err
+	}
+	length := 0
+	for i := 0; i < b.lenSize; i++ {
+		length |= int(fixed[b.lenPos+i]) << (8 * i)
+	}
+	_, err = io.CopyN(io.Discard, f, int64(length*b.lenMul))
+	return err
+}
+
+// parse a TSX file.
+// Only ID 0x4B (Kansas City Standard) blocks are converted to bits, the others are skipped.
+func TSX2bits(wbits io.WriteCloser, f *os.File) *KCSLog {
+	log := &KCSLog{}
+	go func() {
+		defer wbits.Close()
+
+		// file header
+		expected := []byte("ZXTape!\x1a")
+		header := make([]byte, len(expected)+2)
+		_, err := io.ReadFull(f, header)
+		if err != nil {
+			panic(err)
+		}
+		if !slices.Equal(header[0:len(expected)], expected) {
+			panic("no header")
+		}
+		fmt.Fprintf(os.Stderr, "TSX version: %d.%02d\n", header[len(expected)], header[len(expected)+1])
+
+		var bitPos int64
+		for {
+			var id [1]byte
+			_, err := io.ReadFull(f, id[:])
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				panic(err)
+			}
+
+			if id[0] == 0x4b {
+				bits, baud, err := kcsBlock2bits(f)
+				if err != nil {
+					panic(err)
+				}
+				log.add(KCSEvent{Bit: bitPos, Sample: -1, Baud: baud})
+				_, err = wbits.Write(bits)
+				if err != nil {
+					panic(err)
+				}
+				bitPos += int64(len(bits))
+				continue
+			}
+
+			// skip
+			err = skipTZXBlock(f, id[0])
+			if err != nil {
+				panic(err)
+			}
+			fmt.Fprintf(os.Stderr, "TSX block %02x: skipped\n", id[0])
+		}
+	}()
+	return log
+}
+
+// kcsBlock2bits converts a TSX block 0x4B: the leader and the bytes.
+// The baud rate is calculated by the pulse of One.
+func kcsBlock2bits(f io.Reader) ([]byte, int, error) {
+	var h struct {
+		Length      uint32
+		Pause       uint16
+		Pilot       uint16
+		PilotPulses uint16
+		Zero        uint16
+		One         uint16
+		BitConfig   byte
+		ByteConfig  byte
+	}
+	err := binary.Read(f, binary.LittleEndian, &h)
+	if err != nil {
+		return nil, 0, err
+	}
+	if h.Length < 12 || h.One == 0 {
+		return nil, 0, errors.New("invalid TSX block 4B")
+	}
+	data := make([]byte, h.Length-12)
+	_, err = io.ReadFull(f, data)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// config
+	onePulses := int(h.BitConfig & 0x0f)
+	if onePulses == 0 {
+		onePulses = 16
+	}
+	leading := int(h.ByteConfig >> 6)
+	leadingValue := (h.ByteConfig >> 5) & 1
+	trailing := int(h.ByteConfig>>3) & 3
+	trailingValue := (h.ByteConfig >> 2) & 1
+	msbFirst := h.ByteConfig&1 != 0
+
+	// leader: pilot pulses as Ones
+	bits := make([]byte, 0, int(h.PilotPulses)/onePulses+len(data)*(leading+8+trailing))
+	for i := 0; i < int(h.PilotPulses)/onePulses; i++ {
+		bits = append(bits, 1)
+	}
+
+	// bytes
+	for _, d := range data {
+		for i := 0; i < leading; i++ {
+			bits = append(bits, leadingValue)
+		}
+		for i := 0; i < 8; i++ {
+			if msbFirst {
+				bits = append(bits, (d>>(7-i))&1)
+			} else {
+				bits = append(bits, (d>>i)&1)
+			}
+		}
+		for i := 0; i < trailing; i++ {
+			bits = append(bits, trailingValue)
+		}
+	}
+	// a One pulse is a half cycle of the leader
+	baud := baudOfLeader(tsxClock / float64(h.One) / 2)
+	return bits, baud, nil
+}
@@ -0,0 +1,45 @@
+package adc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestSkipTZXBlock(t *testing.T) {
+	tests := []struct {
+		id   byte
+		body []byte
+	}{
+		{0x18, []byte{3, 0, 0, 0, 1, 2, 3}},          // CSW recording
+		{0x23, []byte{0xff, 0xff}},                   // jump to block
+		{0x26, []byte{2, 0, 1, 0, 2, 0}},             // call sequence
+		{0x27, []byte{}},                             // return from sequence
+		{0x28, []byte{3, 0, 1, 2, 0}},                // select block
+		{0x30, []byte{2, 'H', 'I'}},                  // text description
+		{0x35, append(make([]byte, 16), 0, 0, 0, 0)}, // custom info
+	}
+	for _, tt := range tests {
+		r := bytes.NewReader(append(tt.body, 0x4b))
+		if err := skipTZXBlock(r, tt.id); err != nil {
+			t.Errorf("%02x: %v", tt.id, err)
+			continue
+		}
+		// the next block
+		if next, err := r.ReadByte(); err != nil || next != 0x4b {
+			t.Errorf("%02x: next %02x, %v", tt.id, next, err)
+		}
+	}
+
+	err := skipTZXBlock(bytes.NewReader(nil), 0x16)
+	var ube UnsupportedBlockError
+	if !errors.As(err, &ube) || ube != 0x16 {
+		t.Errorf("unknown: %v", err)
+	}
+
+	err = skipTZXBlock(bytes.NewReader([]byte{1}), 0x28)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("short: %v", err)
+	}
+}
@@ -108,7 +108,7 @@ func FBWav2bits(wbits io.WriteCloser, f *os.File) {
 	}()
 }
 
-func KCSWav2bits(wbits io.WriteCloser, f *os.File) {
+func KCSWav2bits(wbits io.WriteCloser, f *os.File) *KCSLog {
 	reader := wav.NewReader(f)
 
 	// input parameters
@@ -152,34 +152,57 @@ func KCSWav2bits(wbits io.WriteCloser, f *os.File) {
 
 	// decode parameters
 	//
-	// KCS 2400 baud:
-	//  Zero: 2400Hz
-	//  One:  4800Hz
-	//
 	// MSX 1200 baud:
 	//  Zero: 1200Hz
 	//  One:  2400Hz
 	//
-	/*
-		minIntervalForZero := int(float32(format.SampleRate/2400/2) * 0.8)
-		maxIntervalForZero := int(float32(format.SampleRate/2400/2) * 1.2)
-		minIntervalForOne := int(float32(format.SampleRate/4800/2) * 0.8)
-		maxIntervalForOne := int(float32(format.SampleRate/4800/2) * 1.2)
-	*/
-	minIntervalForZero := int(float32(format.SampleRate/1200/2) * 0.8)
-	maxIntervalForZero := int(float32(format.SampleRate/1200/2) * 1.2)
-	minIntervalForOne := int(float32(format.SampleRate/2400/2) * 0.8)
-	maxIntervalForOne := int(float32(format.SampleRate/2400/2) * 1.2)
-
-	fmt.Fprintf(os.Stderr, "Zero: %2d <= samples <= %2d\n", minIntervalForZero, maxIntervalForZero)
-	fmt.Fprintf(os.Stderr, "One:  %2d <= samples <= %2d\n", minIntervalForOne, maxIntervalForOne)
+	// MSX 2400 baud:
+	//  Zero: 2400Hz
+	//  One:  4800Hz
+	//
+	// The baud rate is detected by the leader of each file (2400Hz or 4800Hz).
+	var minIntervalForZero, maxIntervalForZero, minIntervalForOne, maxIntervalForOne int
+	setBaud := func(baud int) {
+		half := float64(format.SampleRate) / float64(baud) / 2
+		minIntervalForZero = int(half * 0.8)
+		maxIntervalForZero = int(half * 1.2)
+		minIntervalForOne = int(half / 2 * 0.8)
+		maxIntervalForOne = int(half / 2 * 1.2)
+		fmt.Fprintf(os.Stderr, "%d baud:\n", baud)
+		fmt.Fprintf(os.Stderr, "Zero: %2d <= samples <= %2d\n", minIntervalForZero, maxIntervalForZero)
+		fmt.Fprintf(os.Stderr, "One:  %2d <= samples <= %2d\n", minIntervalForOne, maxIntervalForOne)
+	}
+	baud := 1200
+	setBaud(baud)
 
+	log := &KCSLog{}
 	go func() {
 		defer wbits.Close()
 
+		var bitPos int64
+		var samplePos int64
+		onesRun := 0 // consecutive Ones
+		write := func(b byte) {
+			bit := [1]byte{b}
+			_, err := wbits.Write(bit[:])
+			if err != nil {
+				panic(err)
+			}
+			bitPos++
+			if b == 1 {
+				onesRun++
+			} else {
+				onesRun = 0
+			}
+		}
+
+		// leader: a run of the same half cycles
+		runRef := 0
+		runLen := 0
+		runSum := 0
+
 		interval := -1
 		counterOnes := 0
-		var bit [1]byte
 		for {
 			samples, err := reader.ReadSamples(2048)
 			if err == io.EOF {
@@ -190,6 +213,8 @@ func KCSWav2bits(wbits io.WriteCloser, f *os.File) {
 			}
 
 			for _, sample := range samples {
+				samplePos++
+
 				// fix level
 				value := reader.IntValue(sample, 0) * 7 / 5 // * preAmp // L only
 				if value < thLo {
@@ -217,33 +242,49 @@ func KCSWav2bits(wbits io.WriteCloser, f *os.File) {
 					if interval >= 0 {
 						interval += 1
 
+						// leader
+						if runLen > 0 && runRef-runRef/4-1 <= interval && interval <= runRef+runRef/4+1 {
+							runLen++
+							runSum += interval
+						} else {
+							runRef = interval
+							runLen = 1
+							runSum = interval
+						}
+						if runLen == leaderHalfCycles {
+							hz := float64(format.SampleRate) * float64(runLen) / float64(runSum) / 2
+							b := baudOfLeader(hz)
+							fmt.Fprintf(os.Stderr, "leader: %.0f Hz at %d\n", hz, samplePos)
+							if b != baud {
+								baud = b
+								setBaud(baud)
+								counterOnes = 0
+							}
+							log.add(KCSEvent{Bit: bitPos, Sample: samplePos, Baud: baud})
+						}
+
 						if minIntervalForZero <= interval && interval <= maxIntervalForZero {
 							if counterOnes == 1 {
-								bit[0] = 2 // error?
-								_, err := wbits.Write(bit[:])
-								if err != nil {
-									panic(err)
+								// the half cycle is dropped.
+								// It's not an error at the end of the leader: the number of the half cycles is odd.
+								if onesRun <= 10 {
+									log.add(KCSEvent{Bit: bitPos, Sample: samplePos, Err: ErrLoneHalfCycle})
 								}
 								counterOnes = 0
 							}
-							bit[0] = 0
-							_, err := wbits.Write(bit[:])
-							if err != nil {
-								panic(err)
-							}
+							write(0)
 						} else if minIntervalForOne <= interval && interval <= maxIntervalForOne {
 							if counterOnes == 0 {
 								// 1st
 								counterOnes = 1
 							} else {
 								// 2nd
-								bit[0] = 1
-								_, err := wbits.Write(bit[:])
-								if err != nil {
-									panic(err)
-								}
+								write(1)
 								counterOnes = 0
 							}
+						} else {
+							err := fmt.Errorf("%w: %d samples", ErrInvalidHalfCycle, interval)
+							log.add(KCSEvent{Bit: bitPos, Sample: samplePos, Err: err})
 						}
 
 						// reset count
@@ -253,4 +294,5 @@ func KCSWav2bits(wbits io.WriteCloser, f *os.File) {
 			}
 		}
 	}()
+	return log
 }
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ysh86/CMTtools/fb"
+)
+
+// zeros needed to find the next start code after an error
+const resyncZeros = 100
+
+// bits reader with the position
+type bitReader struct {
+	r   io.Reader
+	pos int64
+	err error // of the source: not the end of the bits
+}
+
+func (br *bitReader) readFull(p []byte) error {
+	n, err := io.ReadFull(br.r, p)
+	br.pos += int64(n)
+	if err == io.EOF && len(p) != 0 {
+		// EOF in a block
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		br.err = err
+	}
+	return err
+}
+
+// skipZeros skips the start code and returns the number of zeros.
+// At least minZeros are needed before the tape mark.
+func (br *bitReader) skipZeros(minZeros int) (int, error) {
+	var bit [1]byte
+	countZeros := 0
+	for {
+		n, err := io.ReadFull(br.r, bit[:])
+		br.pos += int64(n)
+		if err != nil {
+			if err != io.EOF {
+				br.err = err
+			}
+			return countZeros, err
+		}
+		if bit[0] != 0 {
+			if countZeros >= minZeros {
+				return countZeros, nil
+			}
+			countZeros = 0
+			continue
+		}
+		countZeros++
+	}
+}
+
+// block on tape
+type block struct {
+	pos       int64 // bits
+	zeros     int
+	isInfo    bool
+	recovered bool
+	err       error
+
+	// info block
+	attrib   uint16
+	name     []byte
+	reserved uint16
+	dataLen  uint16
+	loadAddr uint16
+	callAddr uint16
+
+	// data block
+	data []byte // bits
+
+	checksum uint16
+	expected *uint16 // nil if the bytes can't be decoded
+	valid    bool    // checksum
+
+	path string // payload written to
+}
+
+func (b *block) kind() string {
+	if b.isInfo {
+		return "info"
+	}
+	return "data"
+}
+
+// readMark reads the tape mark after the 1st one bit.
+func (br *bitReader) readMark(b *block) error {
+	var bits [40]byte
+
+	// tape mark
+	bits[0] = 1
+	err := br.readFull(bits[1:20])
+	if err != nil {
+		return err
+	}
+	for i, v := range bits[0:20] {
+		if v != 1 {
+			return fmt.Errorf("invalid mark bits: %d, %d", i, v)
+		}
+	}
+	// info or data
+	err = br.readFull(bits[0:20])
+	if err != nil {
+		return err
+	}
+	if bits[0] == 1 {
+		// info block
+		b.isInfo = true
+		for i, v := range bits[0:20] {
+			if v != 1 {
+				return fmt.Errorf("invalid info mark bits: %d, %d", i, v)
+			}
+		}
+		err = br.readFull(bits[0:40])
+		if err != nil {
+			return err
+		}
+		for i, v := range bits[0:40] {
+			if v != 0 {
+				return fmt.Errorf("invalid info mark bits: %d, %d", i, v)
+			}
+		}
+	} else {
+		// data block
+		for i, v := range bits[0:20] {
+			if v != 0 {
+				return fmt.Errorf("invalid data mark bits: %d, %d", i, v)
+			}
+		}
+	}
+	return nil
+}
+
+// readInfo reads the info block after the tape mark.
+func (br *bitReader) readInfo(b *block) error {
+	length := 1 + 128*9 + 2*9 + 1
+	bits := make([]byte, length)
+	err := br.readFull(bits)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "info block: %d bits\n", length)
+
+	// validation
+	if bits[0] != 1 {
+		return fmt.Errorf("invalid start bit: %d", bits[0])
+	}
+	b.attrib, _ = bitToByte(1, bits[1:1+9])
+	b.name, _ = bitToBytes16(bits[10 : 10+9*16])
+	b.reserved, _ = bitToByte(1, bits[154:154+9])
+	b.dataLen, _ = bitToByte(2, bits[163:163+9*2])
+	b.loadAddr, _ = bitToByte(2, bits[181:181+9*2])
+	b.callAddr, _ = bitToByte(2, bits[199:199+9*2])
+	// emp: 104*9 [bits]
+	b.checksum, _ = bitToByte(2, bits[length-1-9*2:length-1])
+	if bits[length-1] != 1 {
+		return fmt.Errorf("invalid end bit: %d", bits[length-1])
+	}
+	fmt.Fprintf(out, "attrib:   %02x\n", b.attrib)
+	fmt.Fprintf(out, "name:     %s\n", fb.CharsToString(b.name))
+	fmt.Fprintf(out, "reserved: %02x\n", b.reserved)
+	fmt.Fprintf(out, "dataLen:  %04x\n", b.dataLen)
+	fmt.Fprintf(out, "loadAddr: %04x\n", b.loadAddr)
+	fmt.Fprintf(out, "callAddr: %04x\n", b.callAddr)
+	checkChecksum(b, bits[1:1+128*9])
+	return nil
+}
+
+// readData reads the data block after the tape mark.
+func (br *bitReader) readData(b *block, info *block) error {
+	if info == nil {
+		return errors.New("data block without info block")
+	}
+	b.attrib = info.attrib
+	b.name = info.name
+	b.dataLen = info.dataLen
+
+	length := 1 + int(b.dataLen)*9 + 9*2 + 1
+	fmt.Fprintf(out, "data block: %d bits\n", length)
+
+	// validation
+	var bits [18]byte
+	err := br.readFull(bits[0:1])
+	if err != nil {
+		return err
+	}
+	if bits[0] != 1 {
+		return fmt.Errorf("invalid start bit: %d", bits[0])
+	}
+
+	// data
+	b.data = make([]byte, int(b.dataLen)*9)
+	err = br.readFull(b.data)
+	if err != nil {
+		return err
+	}
+	err = dumpData(b.attrib, b.data)
+	if err != nil {
+		fmt.Fprintf(out, "%v\n", err)
+	}
+
+	// checksum
+	err = br.readFull(bits[0:18])
+	if err != nil {
+		return err
+	}
+	b.checksum, _ = bitToByte(2, bits[0:18])
+	checkChecksum(b, b.data)
+
+	// validation
+	err = br.readFull(bits[0:1])
+	if err != nil {
+		return err
+	}
+	if bits[0] != 1 {
+		return fmt.Errorf("invalid end bit: %d", bits[0])
+	}
+	return nil
+}
+
+// JSON record of a block
+type blockRecord struct {
+	Index      int    `json:"index"`
+	Pos        int64  `json:"pos"`
+	StartZeros int    `json:"startZeros"`
+	Type       string `json:"type"`   // info, data
+	Status     string `json:"status"` // ok, recovered, lost
+	Error      string `json:"error,omitempty"`
+
+	Attrib   *uint16 `json:"attrib,omitempty"`
+	Name     *string `json:"name,omitempty"`
+	Reserved *uint16 `json:"reserved,omitempty"`
+	DataLen  *uint16 `json:"dataLen,omitempty"`
+	LoadAddr *uint16 `json:"loadAddr,omitempty"`
+	CallAddr *uint16 `json:"callAddr,omitempty"`
+
+	Checksum         *uint16 `json:"checksum,omitempty"`
+	ComputedChecksum *uint16 `json:"computedChecksum,omitempty"`
+	ChecksumValid    *bool   `json:"checksumValid,omitempty"`
+
+	// payload of the data block: inline or file
+	Encoding string `json:"encoding,omitempty"` // hex
+	Payload  string `json:"payload,omitempty"`
+	Path     string `json:"path,omitempty"`
+}
+
+func (b *block) record(index int) *blockRecord {
+	r := &blockRecord{
+		Index:      index,
+		Pos:        b.pos,
+		StartZeros: b.zeros,
+		Type:       b.kind(),
+		Status:     "ok",
+	}
+	if b.err != nil {
+		r.Status = "lost"
+		r.Error = b.err.Error()
+		return r
+	}
+	if b.recovered {
+		r.Status = "recovered"
+	}
+
+	name := fb.CharsToString(b.name)
+	r.Attrib = &b.attrib
+	r.Name = &name
+	r.DataLen = &b.dataLen
+	if b.isInfo {
+		r.Reserved = &b.reserved
+		r.LoadAddr = &b.loadAddr
+		r.CallAddr = &b.callAddr
+	}
+	r.Checksum = &b.checksum
+	if b.expected != nil {
+		r.ComputedChecksum = b.expected
+		r.ChecksumValid = &b.valid
+	}
+
+	if !b.isInfo {
+		if b.path != "" {
+			r.Path = b.path
+		} else {
+			data, err := bitToBytes(b.data)
+			if err != nil {
+				r.Error = fmt.Sprintf("payload: %v", err)
+			} else {
+				r.Encoding = "hex"
+				r.Payload = hex.EncodeToString(data)
+			}
+		}
+	}
+	return r
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"flag"
 	"fmt"
+	"image/png"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	adConverter "github.com/ysh86/CMTtools/adc"
+	"github.com/ysh86/CMTtools/fb"
 )
 
 func bitToByte(length int, bits []byte) (uint16, error) {
@@ -56,64 +60,174 @@ func bitToBytes16(bits []byte) ([]byte, error) {
 	return ret[:], nil
 }
 
-func dumpData(attrib uint16, bits []byte) {
+func bitToBytes(bits []byte) ([]byte, error) {
+	if len(bits)%9 != 0 {
+		return nil, errors.New("invalid length")
+	}
+
+	ret := make([]byte, len(bits)/9)
+	for i := range ret {
+		b, err := bitToByte(1, bits[i*9:i*9+9])
+		if err != nil {
+			return nil, err
+		}
+		ret[i] = byte(b & 0xff)
+	}
+
+	return ret, nil
+}
+
+// output of the text mode
+var out io.Writer = os.Stdout
+
+// checkChecksum validates the checksum of the block.
+func checkChecksum(b *block, bits []byte) {
+	data, err := bitToBytes(bits)
+	if err != nil {
+		fmt.Fprintf(out, "checksum: %04x NG: %v\n", b.checksum, err)
+		return
+	}
+	expected := fb.Checksum(data)
+	b.expected = &expected
+	b.valid = b.checksum == expected
+	if !b.valid {
+		fmt.Fprintf(out, "checksum: %04x NG: expected %04x\n", b.checksum, expected)
+		return
+	}
+	fmt.Fprintf(out, "checksum: %04x OK\n", b.checksum)
+}
+
+func dumpData(attrib uint16, bits []byte) error {
 	cur := 0
-	if attrib == 0x02 {
+	if attrib == fb.AttribBASIC {
 		// BASIC code
 		for cur < len(bits) {
 			lineLen, _ := bitToByte(1, bits[cur:cur+9])
 			if lineLen == 0 {
 				// end mark: 0x00
 				cur = cur + 9
-				fmt.Printf("end of data: %d\n", cur)
+				fmt.Fprintf(out, "end of data: %d\n", cur)
 				break
 			}
-			//fmt.Printf("%3d: ", lineLen)
+			//fmt.Fprintf(out, "%3d: ", lineLen)
+			if lineLen < 1+2 || cur+int(lineLen)*9 > len(bits) {
+				return fmt.Errorf("invalid line length: %d, cur=%d", lineLen, cur)
+			}
 			lineLen -= 1
 			cur = cur + 9
 
 			lineNum, _ := bitToByte(2, bits[cur:cur+9*2])
 			lineLen -= 2
 			cur = cur + 9*2
-			fmt.Printf("%4d %3d,", lineNum, lineLen)
+			fmt.Fprintf(out, "%4d %3d,", lineNum, lineLen)
 
+			body := make([]byte, 0, lineLen)
 			for l := 0; l < int(lineLen); l++ {
 				b, _ := bitToByte(1, bits[cur:cur+9])
-				fmt.Printf(" %02x", b)
+				fmt.Fprintf(out, " %02x", b)
+				body = append(body, byte(b))
 				cur += 9
 			}
-			fmt.Println("")
+			fmt.Fprintln(out, "")
+
+			// listing
+			txt, err := fb.Detokenize(body)
+			if err != nil {
+				fmt.Fprintf(out, "     > %d %s ... %v\n", lineNum, txt, err)
+			} else {
+				fmt.Fprintf(out, "     > %d %s\n", lineNum, txt)
+			}
 		}
+	} else if attrib == fb.AttribBG && len(bits) == fb.BGLen*9 {
+		// BG GRAPHIC
+		data, err := bitToBytes(bits)
+		if err != nil {
+			return err
+		}
+		bg, err := fb.ParseBG(data)
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(out, bg.String())
+		cur = len(bits)
 	} else {
 		// BG2 dump
 		pos := 0
 		for cur < len(bits) {
 			b, err := bitToByte(1, bits[cur:cur+9])
 			if err != nil {
-				panic(err)
+				fmt.Fprintf(out, "\n")
+				return fmt.Errorf("%w: cur=%d", err, cur)
 			}
 			cur = cur + 9
 			pos++
-			fmt.Printf(" %02x", b)
+			fmt.Fprintf(out, " %02x", b)
 			if pos&0xf == 0 {
-				fmt.Printf("\n")
+				fmt.Fprintf(out, "\n")
 			}
 		}
 		if pos&0xf != 0 {
-			fmt.Printf("\n")
+			fmt.Fprintf(out, "\n")
 		}
 	}
 
 	if cur != len(bits) {
-		panic(fmt.Errorf("invalid data: cur=%d, len=%d", cur, len(bits)))
+		return fmt.Errorf("invalid data: cur=%d, len=%d", cur, len(bits))
+	}
+	return nil
+}
+
+func writePNG(path string, data []byte, chr fb.CHR, pal *fb.Palettes) error {
+	bg, err := fb.ParseBG(data)
+	if err != nil {
+		return err
 	}
+	fw, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fw.Close()
+	return png.Encode(fw, bg.Image(chr, pal))
 }
 
 func main() {
 	inFile := flag.String("infile", "", "wav/trace file to decode")
+	chrFile := flag.String("chr", "", "BG character set (4KB pattern table) to render BG GRAPHIC")
+	palet := flag.String("palet", "", "BG palettes: 0f301627,0f2a1a0a,0f211201,0f281707")
+	profileName := flag.String("profile", "V2.1A", "timing of trace log: V2.1A or auto")
+	zero := flag.Int("zero", 0, "trace: DEC count of Zero (default: by the profile)")
+	one := flag.Int("one", 0, "trace: DEC count of One (default: by the profile)")
+	tolerance := flag.Int("tolerance", -1, "trace: tolerance of the counts (default: by the profile)")
+	jsonOut := flag.Bool("json", false, "output JSON lines: a record per block")
+	outDir := flag.String("outdir", "", "directory to write payloads of data blocks")
 	flag.Parse()
-	if len(os.Args) == 2 {
-		inFile = &os.Args[1]
+	if len(flag.Args()) == 1 {
+		inFile = &flag.Args()[0]
+	}
+	if *jsonOut {
+		out = io.Discard
+	}
+	enc := json.NewEncoder(os.Stdout)
+
+	// BG GRAPHIC
+	chr := fb.PlaceholderCHR()
+	if *chrFile != "" {
+		b, err := os.ReadFile(*chrFile)
+		if err != nil {
+			panic(err)
+		}
+		chr, err = fb.ParseCHR(b)
+		if err != nil {
+			panic(err)
+		}
+	}
+	pal := &fb.DefaultPalettes
+	if *palet != "" {
+		var err error
+		pal, err = fb.ParsePalettes(*palet)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	// in
@@ -135,149 +249,151 @@ func main() {
 	if strings.HasSuffix(*inFile, ".wav") {
 		adConverter.FBWav2bits(wbits, f)
 	} else {
-		adConverter.FBPort2bits(wbits, f)
+		profile, ok := adConverter.FBProfiles[*profileName]
+		if !ok {
+			panic(fmt.Errorf("unknown profile: %s", *profileName))
+		}
+		if *zero != 0 || *one != 0 || *tolerance >= 0 {
+			profile.Name = "custom"
+		}
+		if *zero != 0 {
+			profile.Zero = *zero
+		}
+		if *one != 0 {
+			profile.One = *one
+		}
+		if *tolerance >= 0 {
+			profile.Tolerance = *tolerance
+		}
+		err = adConverter.FBPort2bits(wbits, f, profile)
+		if err != nil {
+			panic(err)
+		}
 	}
 
 	// step2: bits to Tape blocks
+	var blocks []*block
+	br := &bitReader{r: rbits}
 	errc := make(chan interface{})
 	go func() {
 		defer close(errc)
 
-		var bits [1024 * 9]byte
-		var dataLen uint16
-		var attrib uint16
+		var info *block
+		resync := false
 		for {
 			// skip start code
-			countZeros := 0
-			for {
-				_, err := io.ReadFull(rbits, bits[0:1])
-				if err == io.EOF {
-					fmt.Printf("---- EOF ----\n")
-					return
-				}
-				if err != nil {
-					panic(err)
-				}
-				if bits[0] != 0 {
-					break
-				}
-				countZeros++
+			minZeros := 0
+			if resync {
+				minZeros = resyncZeros
+			}
+			countZeros, err := br.skipZeros(minZeros)
+			if err == io.EOF {
+				fmt.Fprintf(out, "---- EOF ----\n")
+				return
 			}
-			fmt.Printf("---- block start ----\n")
-			fmt.Printf("start zeros: %d\n", countZeros)
-
-			// tape mark
-			_, err := io.ReadFull(rbits, bits[1:20])
 			if err != nil {
-				panic(err)
+				fmt.Fprintf(out, "---- %v ----\n", err)
+				return
 			}
-			for i, b := range bits[0:20] {
-				if b != 1 {
-					panic(fmt.Errorf("invalid mark bits: %d, %d", i, b))
+			fmt.Fprintf(out, "---- block start ----\n")
+			fmt.Fprintf(out, "start zeros: %d\n", countZeros)
+
+			b := &block{pos: br.pos - 1, zeros: countZeros, recovered: resync}
+			blocks = append(blocks, b)
+			err = br.readMark(b)
+			if err == nil {
+				if b.isInfo {
+					err = br.readInfo(b)
+				} else {
+					err = br.readData(b, info)
 				}
 			}
-			// info or data
-			isInfo := false
-			_, err = io.ReadFull(rbits, bits[0:20])
 			if err != nil {
-				panic(err)
-			}
-			if bits[0] == 1 {
-				// info block
-				for i, b := range bits[0:20] {
-					if b != 1 {
-						panic(fmt.Errorf("invalid info mark bits: %d, %d", i, b))
-					}
+				b.err = err
+				fmt.Fprintf(out, "error: %s block at bit %d: %v\n", b.kind(), br.pos, err)
+				if *jsonOut {
+					enc.Encode(b.record(len(blocks) - 1))
 				}
-				_, err = io.ReadFull(rbits, bits[0:40])
-				if err != nil {
-					panic(err)
+				if b.isInfo {
+					// the length of the data is unknown
+					info = nil
 				}
-				for i, b := range bits[0:40] {
-					if b != 0 {
-						panic(fmt.Errorf("invalid info mark bits: %d, %d", i, b))
-					}
+				if err == io.ErrUnexpectedEOF {
+					fmt.Fprintf(out, "---- EOF ----\n")
+					return
 				}
-				isInfo = true
-			} else {
-				// data block
-				for i, b := range bits[0:20] {
-					if b != 0 {
-						panic(fmt.Errorf("invalid data mark bits: %d, %d", i, b))
-					}
+				if br.err != nil {
+					fmt.Fprintf(out, "---- %v ----\n", br.err)
+					return
 				}
+				resync = true
+				continue
 			}
+			resync = false
 
-			if isInfo {
-				length := 1 + 128*9 + 2*9 + 1
-				_, err := io.ReadFull(rbits, bits[0:length])
-				if err != nil {
-					panic(err)
-				}
-				fmt.Printf("info block: %d bits\n", length)
-
-				// validation
-				if bits[0] != 1 {
-					panic(fmt.Errorf("invalid start bit: %d", bits[0]))
-				}
-				attrib, _ = bitToByte(1, bits[1:1+9])
-				name, _ := bitToBytes16(bits[10 : 10+9*16])
-				reserved, _ := bitToByte(1, bits[154:154+9])
-				dataLen, _ = bitToByte(2, bits[163:163+9*2])
-				loadAddr, _ := bitToByte(2, bits[181:181+9*2])
-				callAddr, _ := bitToByte(2, bits[199:199+9*2])
-				// emp: 104*9 [bits]
-				checksum, _ := bitToByte(2, bits[length-1-9*2:length-1])
-				if bits[length-1] != 1 {
-					panic(fmt.Errorf("invalid end bit: %d", bits[length-1]))
-				}
-				fmt.Printf("attrib:   %02x\n", attrib)
-				fmt.Printf("name:     %s\n", string(name))
-				fmt.Printf("reserved: %02x\n", reserved)
-				fmt.Printf("dataLen:  %04x\n", dataLen)
-				fmt.Printf("loadAddr: %04x\n", loadAddr)
-				fmt.Printf("callAddr: %04x\n", callAddr)
-				fmt.Printf("checksum: %04x\n", checksum)
+			if b.isInfo {
+				info = b
 			} else {
-				length := 1 + dataLen*9 + 9*2 + 1
-				fmt.Printf("data block: %d bits\n", length)
-
-				// validation
-				_, err := io.ReadFull(rbits, bits[0:1])
-				if err != nil {
-					panic(err)
-				}
-				if bits[0] != 1 {
-					panic(fmt.Errorf("invalid start bit: %d", bits[0]))
-				}
-
-				// data
-				data := make([]byte, dataLen*9)
-				_, err = io.ReadFull(rbits, data)
-				if err != nil {
-					panic(err)
-				}
-				dumpData(attrib, data)
-
-				// checksum
-				_, err = io.ReadFull(rbits, bits[0:18])
-				if err != nil {
-					panic(err)
-				}
-				checksum, _ := bitToByte(2, bits[0:18])
-				fmt.Printf("checksum: %04x\n", checksum)
-
-				// validation
-				_, err = io.ReadFull(rbits, bits[0:1])
+				data, err := bitToBytes(b.data)
 				if err != nil {
-					panic(err)
-				}
-				if bits[0] != 1 {
-					panic(fmt.Errorf("invalid end bit: %d", bits[0]))
+					fmt.Fprintf(out, "payload: %v\n", err)
+				} else {
+					if *outDir != "" {
+						b.path = filepath.Join(*outDir, fmt.Sprintf("%02d_%s.bin", len(blocks)-1, fb.FileName(b.name)))
+						err = os.WriteFile(b.path, data, 0666)
+						if err != nil {
+							panic(err)
+						}
+						fmt.Fprintf(out, "payload: %s\n", b.path)
+					}
+					if b.attrib == fb.AttribBG && int(b.dataLen) == fb.BGLen {
+						pngFile := fmt.Sprintf("%s.%02d.png", *inFile, len(blocks)-1)
+						err = writePNG(pngFile, data, chr, pal)
+						if err != nil {
+							panic(err)
+						}
+						fmt.Fprintf(out, "BG: %s\n", pngFile)
+					}
 				}
 			}
+			if *jsonOut {
+				enc.Encode(b.record(len(blocks) - 1))
+			}
 		}
 	}()
 
 	<-errc
+
+	// summary
+	numBadBlocks := 0
+	numLostBlocks := 0
+	fmt.Fprintf(out, "---- summary ----\n")
+	for i, b := range blocks {
+		status := "OK"
+		if b.err != nil {
+			status = fmt.Sprintf("lost: %v", b.err)
+			numLostBlocks++
+		} else {
+			if b.recovered {
+				status = "recovered"
+			}
+			if !b.valid {
+				status += ", checksum NG"
+				numBadBlocks++
+			}
+		}
+		fmt.Fprintf(out, "%3d: %s block at bit %d: %s\n", i, b.kind(), b.pos, status)
+	}
+	fmt.Fprintf(out, "blocks: %d, bad checksums: %d, lost: %d\n", len(blocks), numBadBlocks, numLostBlocks)
+	if br.err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", br.err)
+		os.Exit(1)
+	}
+	if len(blocks) == 0 {
+		fmt.Fprintf(os.Stderr, "error: no blocks\n")
+		os.Exit(1)
+	}
+	if numBadBlocks != 0 || numLostBlocks != 0 {
+		os.Exit(1)
+	}
 }
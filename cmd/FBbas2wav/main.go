@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ysh86/CMTtools/dac"
+	"github.com/ysh86/CMTtools/fb"
+)
+
+func main() {
+	var inFile string
+	var outFile string
+	var name string
+	var loadAddr uint
+	var callAddr uint
+
+	flag.StringVar(&inFile, "infile", "-", "BASIC text file to read")
+	flag.StringVar(&outFile, "outfile", "", "wav file to write (default: infile.wav)")
+	flag.StringVar(&name, "name", "", "file name on tape (default: infile)")
+	flag.UintVar(&loadAddr, "load", 0x6006, "load address")
+	flag.UintVar(&callAddr, "call", 0x0000, "call address")
+	flag.Parse()
+	if len(flag.Args()) == 1 {
+		inFile = flag.Arg(0)
+	}
+
+	// in
+	var err error
+	var f *os.File
+	if inFile == "-" {
+		f = os.Stdin
+		if outFile == "" {
+			outFile = "stdin.wav"
+		}
+	} else {
+		f, err = os.Open(inFile)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		if outFile == "" {
+			outFile = inFile + ".wav"
+		}
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(inFile), filepath.Ext(inFile))
+		}
+	}
+	name = strings.ToUpper(name)
+	if len(name) > fb.NameLen {
+		name = name[0:fb.NameLen]
+	}
+
+	// step1: text to lines
+	var lines []fb.Line
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), " \r")
+		if text == "" {
+			continue
+		}
+		line, err := fb.TokenizeLine(text)
+		if err != nil {
+			panic(err)
+		}
+		if len(lines) != 0 && line.Number <= lines[len(lines)-1].Number {
+			panic(fmt.Errorf("line %d: not in ascending order", line.Number))
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+
+	// step2: lines to blocks
+	data, err := fb.Program(lines)
+	if err != nil {
+		panic(err)
+	}
+	info := fb.Info{
+		Attrib:   fb.AttribBASIC,
+		Name:     name,
+		DataLen:  uint16(len(data)),
+		LoadAddr: uint16(loadAddr),
+		CallAddr: uint16(callAddr),
+	}
+	bits, err := fb.TapeBits(&info, data)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(os.Stderr, "lines:    %d\n", len(lines))
+	fmt.Fprintf(os.Stderr, "name:     %s\n", info.Name)
+	fmt.Fprintf(os.Stderr, "dataLen:  %04x\n", info.DataLen)
+	fmt.Fprintf(os.Stderr, "loadAddr: %04x\n", info.LoadAddr)
+	fmt.Fprintf(os.Stderr, "callAddr: %04x\n", info.CallAddr)
+	fmt.Fprintf(os.Stderr, "checksum: %04x, %04x\n", fb.Checksum(info.Bytes()), fb.Checksum(data))
+
+	// step3: bits to wav
+	fwav, err := os.Create(outFile)
+	if err != nil {
+		panic(err)
+	}
+	defer fwav.Close()
+	err = dac.FBBits2wav(fwav, bits, &dac.DefaultFormat)
+	if err != nil {
+		panic(err)
+	}
+}
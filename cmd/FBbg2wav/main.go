@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ysh86/CMTtools/dac"
+	"github.com/ysh86/CMTtools/fb"
+)
+
+func main() {
+	var inFile string
+	var outFile string
+	var name string
+	var chrFile string
+	var palet string
+
+	flag.StringVar(&inFile, "infile", "", "png (256x240) or tile map text to read")
+	flag.StringVar(&outFile, "outfile", "", "wav file to write (default: infile.wav)")
+	flag.StringVar(&name, "name", "", "file name on tape (default: infile)")
+	flag.StringVar(&chrFile, "chr", "", "BG character set (4KB pattern table) to convert png")
+	flag.StringVar(&palet, "palet", "", "BG palettes: 0f301627,0f2a1a0a,0f211201,0f281707")
+	flag.Parse()
+	if len(flag.Args()) == 1 {
+		inFile = flag.Arg(0)
+	}
+	if outFile == "" {
+		outFile = inFile + ".wav"
+	}
+	if name == "" {
+		name = strings.TrimSuffix(filepath.Base(inFile), filepath.Ext(inFile))
+	}
+	name = strings.ToUpper(name)
+	if len(name) > fb.NameLen {
+		name = name[0:fb.NameLen]
+	}
+
+	// in
+	f, err := os.Open(inFile)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	// step1: png/text to BG
+	var bg *fb.BG
+	if strings.HasSuffix(strings.ToLower(inFile), ".png") {
+		chr := fb.PlaceholderCHR()
+		if chrFile != "" {
+			b, err := os.ReadFile(chrFile)
+			if err != nil {
+				panic(err)
+			}
+			chr, err = fb.ParseCHR(b)
+			if err != nil {
+				panic(err)
+			}
+		}
+		pal := &fb.DefaultPalettes
+		if palet != "" {
+			pal, err = fb.ParsePalettes(palet)
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		img, err := png.Decode(f)
+		if err != nil {
+			panic(err)
+		}
+		var mismatches int
+		bg, mismatches, err = fb.BGFromImage(img, chr, pal)
+		if err != nil {
+			panic(err)
+		}
+		if mismatches != 0 {
+			fmt.Fprintf(os.Stderr, "warning: %d tiles are not in the CHR, replaced with the nearest\n", mismatches)
+		}
+	} else {
+		bg, err = fb.ParseBGText(f)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// step2: BG to blocks
+	data := bg.Bytes()
+	info := fb.Info{
+		Attrib:  fb.AttribBG,
+		Name:    name,
+		DataLen: uint16(len(data)),
+	}
+	bits, err := fb.TapeBits(&info, data)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(os.Stderr, "name:     %s\n", info.Name)
+	fmt.Fprintf(os.Stderr, "dataLen:  %04x\n", info.DataLen)
+	fmt.Fprintf(os.Stderr, "checksum: %04x, %04x\n", fb.Checksum(info.Bytes()), fb.Checksum(data))
+
+	// step3: bits to wav
+	fwav, err := os.Create(outFile)
+	if err != nil {
+		panic(err)
+	}
+	defer fwav.Close()
+	err = dac.FBBits2wav(fwav, bits, &dac.DefaultFormat)
+	if err != nil {
+		panic(err)
+	}
+}
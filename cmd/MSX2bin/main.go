@@ -1,28 +1,45 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"strings"
 
 	adConverter "github.com/ysh86/CMTtools/adc"
+	"github.com/ysh86/CMTtools/msx"
 )
 
 func main() {
-	inFile := flag.String("infile", "-", "wav file to read")
+	inFile := flag.String("infile", "-", "wav or tsx file to read")
+	raw := flag.Bool("raw", false, "write the bytes of all blocks back-to-back (.bin) instead of .cas")
+	tsx := flag.Bool("tsx", false, "write a TSX file (.tsx) instead of .cas")
+	disasm := flag.Bool("disasm", false, "list Z80 disassembly of the binary files")
+	outDir := flag.String("outdir", ".", "directory to write the files: NN_NAME.bas/.asc/.bin, empty for none")
+	dsk := flag.Bool("dsk", false, "write the files to an MSX-DOS disk image (.dsk)")
+	autoexec := flag.Bool("autoexec", false, "add AUTOEXEC.BAS to run the files on the disk image")
 	flag.Parse()
-	if len(os.Args) == 2 {
-		inFile = &os.Args[1]
+	if flag.NArg() > 0 {
+		inFile = &flag.Args()[0]
 	}
 
 	// in
 	var err error
 	var f *os.File
-	outFile := *inFile + ".bin"
+	ext := ".cas"
+	if *raw {
+		ext = ".bin"
+	}
+	if *tsx {
+		ext = ".tsx"
+	}
+	outFile := *inFile + ext
 	if *inFile == "-" {
 		f = os.Stdin
-		outFile = "stdin.bin"
+		outFile = "stdin" + ext
 	} else {
 		f, err = os.Open(*inFile)
 		if err != nil {
@@ -37,13 +54,29 @@ func main() {
 		panic(err)
 	}
 	defer fw.Close()
+	var cas *msx.CASWriter
+	if *tsx {
+		// written after all blocks
+		cas = msx.NewCASWriter(io.Discard)
+	} else {
+		cas = msx.NewCASWriter(fw)
+	}
 
-	// step1: wav to bits
+	// step1: wav or tsx to bits
 	rbits, wbits := io.Pipe()
 	defer rbits.Close()
-	adConverter.KCSWav2bits(wbits, f)
+	var log *adConverter.KCSLog
+	if strings.EqualFold(filepath.Ext(*inFile), ".tsx") {
+		log = adConverter.TSX2bits(wbits, f)
+	} else {
+		log = adConverter.KCSWav2bits(wbits, f)
+	}
+	rb := adConverter.NewBitCounter(rbits)
 
 	// step2: bits to bytes
+	var blocks [][]byte
+	var bauds []int
+	var suspects []int // bytes with demodulation errors in each block
 	done := make(chan interface{})
 	go func() {
 		defer close(done)
@@ -56,9 +89,9 @@ func main() {
 	LOOP:
 		// skip start code
 		fmt.Fprintln(os.Stderr, "")
-		fmt.Fprintf(os.Stderr, "==== CAS file ====\n")
+		fmt.Fprintf(os.Stderr, "==== CAS block ====\n")
 		for {
-			_, err := io.ReadFull(rbits, bits[0:1])
+			_, err := io.ReadFull(rb, bits[0:1])
 			if err != nil {
 				break
 			}
@@ -69,10 +102,16 @@ func main() {
 			countOnes++
 		}
 		fmt.Fprintf(os.Stderr, "skip ones: %d\n", countOnes)
+		baud := log.Baud(rb.Pos())
+		if baud == 0 {
+			// no leader
+			baud = 1200
+		}
+		fmt.Fprintf(os.Stderr, "baud:  %d\n", baud)
 		fmt.Fprintf(os.Stderr, "start: %04x, %04x\n", globalPos+pos, 0)
 		fmt.Fprintf(os.Stderr, "------------------\n")
 
-		_, err := io.ReadFull(rbits, bits[1:])
+		_, err := io.ReadFull(rb, bits[1:])
 		if err == io.EOF || err == io.ErrUnexpectedEOF {
 			return
 		}
@@ -82,25 +121,73 @@ func main() {
 
 		globalPos += pos
 		pos = 0
-		for {
-			data, err := bitToByte(bits[:])
-			if err == io.EOF {
-				countOnes = 11
-				fmt.Fprintf(os.Stderr, "------------------\n")
-				fmt.Fprintf(os.Stderr, "end:   %04x, %04x\n", globalPos+pos, pos)
-				fmt.Fprintf(os.Stderr, "==================\n")
-				goto LOOP
-			}
+		blocks = append(blocks, nil)
+		bauds = append(bauds, baud)
+		suspects = append(suspects, 0)
+		if !*raw && !*tsx {
+			// new leader & start of data
+			err := cas.StartBlock()
 			if err != nil {
 				panic(err)
 			}
+		}
+		for {
+			// demodulation errors in the bits of the byte
+			errs := log.Errors(rb.Pos()-int64(len(bits)), rb.Pos())
+			var data []byte
+			framed := true
+			if len(errs) > 0 && bytes.IndexByte(bits[:], 0) >= 0 {
+				// keep the byte even if the frame is broken, all ones are the end of the block
+				var b byte
+				b, framed = adConverter.KCSFrame(bits[:])
+				if bits[0] == 0 {
+					data = []byte{b}
+					for _, e := range errs {
+						fmt.Fprintf(os.Stderr, "suspect: %04x: %02x: %v (sample %d)\n", pos, b, e.Err, e.Sample)
+					}
+					if !framed {
+						fmt.Fprintf(os.Stderr, "suspect: %04x: %02x: broken frame, resync\n", pos, b)
+					}
+					suspects[len(suspects)-1]++
+				} else {
+					// re-framed by resync
+					fmt.Fprintf(os.Stderr, "suspect: %04x: no start bit: %v (sample %d), resync\n", pos, errs[0].Err, errs[0].Sample)
+				}
+			} else {
+				data, err = bitToByte(bits[:])
+				if err == io.EOF {
+					countOnes = 11
+					fmt.Fprintf(os.Stderr, "------------------\n")
+					fmt.Fprintf(os.Stderr, "end:   %04x, %04x\n", globalPos+pos, pos)
+					fmt.Fprintf(os.Stderr, "==================\n")
+					goto LOOP
+				}
+				if err != nil {
+					panic(err)
+				}
+			}
+
 			// output
-			//fmt.Fprintf(os.Stderr, "%04x: %02x\n", pos, data[0])
-			fw.Write(data)
-			pos++
+			if data != nil {
+				//fmt.Fprintf(os.Stderr, "%04x: %02x\n", pos, data[0])
+				cas.Write(data)
+				blocks[len(blocks)-1] = append(blocks[len(blocks)-1], data...)
+				pos++
+			}
 
 			// next
-			_, err = io.ReadFull(rbits, bits[:])
+			if framed {
+				_, err = io.ReadFull(rb, bits[:])
+			} else {
+				err = adConverter.KCSResync(rb, bits[:])
+				if err == adConverter.ErrEndOfBlock {
+					countOnes = 11
+					fmt.Fprintf(os.Stderr, "------------------\n")
+					fmt.Fprintf(os.Stderr, "end:   %04x, %04x\n", globalPos+pos, pos)
+					fmt.Fprintf(os.Stderr, "==================\n")
+					goto LOOP
+				}
+			}
 			if err == io.EOF || err == io.ErrUnexpectedEOF {
 				fmt.Fprintf(os.Stderr, "end:   %04x, %04x\n", globalPos+pos, pos)
 				fmt.Fprintf(os.Stderr, "==================\n")
@@ -116,6 +203,170 @@ func main() {
 
 	// wait to finish
 	<-done
+	if *tsx {
+		err := msx.WriteTSX(fw, blocks, bauds)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// step3: blocks to files
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintf(os.Stderr, "---- files ----\n")
+	files := msx.Files(blocks)
+	for i, file := range files {
+		if file.Header == nil {
+			fmt.Fprintf(os.Stderr, "%2d: %-6s %-6s %5d bytes %4d baud, %d suspect bytes: no header\n", i, "-", "", len(file.Data), bauds[file.Index], suspects[file.Index])
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%2d: %-6s %-6s %5d bytes %4d baud", i, file.Type, file.Name, len(file.Data), bauds[file.Index])
+		n := 0
+		for _, s := range suspects[file.Index : file.Index+file.Count] {
+			n += s
+		}
+		if n > 0 {
+			fmt.Fprintf(os.Stderr, ", %d suspect bytes", n)
+		}
+		if file.Data == nil {
+			fmt.Fprintf(os.Stderr, ": no data\n")
+			continue
+		}
+		if file.Count > 2 {
+			fmt.Fprintf(os.Stderr, ", %d blocks", file.Count-1)
+		}
+		data := file.Data
+		if file.Type == msx.TypeASCII {
+			// until EOF
+			if i := bytes.IndexByte(data, msx.ASCIIEOF); i >= 0 {
+				data = data[0 : i+1]
+			}
+		}
+		path := ""
+		if *outDir != "" {
+			path = filepath.Join(*outDir, fmt.Sprintf("%02d_%s%s", i, msx.FileName(file.Name), file.Type.Ext()))
+			err := os.WriteFile(path, data, 0666)
+			if err != nil {
+				panic(err)
+			}
+			fmt.Fprintf(os.Stderr, " -> %s", path)
+		}
+		fmt.Fprintln(os.Stderr, "")
+
+		// listing
+		switch file.Type {
+		case msx.TypeBASIC:
+			txt, err := msx.List(file.Data)
+			printListing(txt)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			}
+			writeListing(path, file.Type.Ext(), ".txt", txt)
+		case msx.TypeASCII:
+			txt := msx.Text(data)
+			printListing(txt)
+			writeListing(path, file.Type.Ext(), ".txt", txt)
+		case msx.TypeBinary:
+			h, code, err := msx.ParseBinary(file.Data)
+			if h != nil {
+				fmt.Fprintf(os.Stderr, "     %s\n", h)
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			}
+			if code == nil {
+				continue
+			}
+			if path != "" {
+				// machine code only: NN_NAME.ADDR.bin
+				codePath := strings.TrimSuffix(path, file.Type.Ext()) + fmt.Sprintf(".%04X.bin", h.Start)
+				err := os.WriteFile(codePath, code, 0666)
+				if err != nil {
+					panic(err)
+				}
+				fmt.Fprintf(os.Stderr, "     -> %s\n", codePath)
+			}
+			if *disasm {
+				txt := fmt.Sprintf("; %s\n", h) + msx.Disassemble(code, h.Start)
+				printListing(txt)
+				writeListing(path, file.Type.Ext(), ".asm", txt)
+			}
+		}
+	}
+
+	// step4: files to disk
+	if *dsk {
+		writeDisk(*inFile, files, *autoexec)
+	}
+}
+
+// writeDisk writes the files with the headers to inFile.dsk.
+func writeDisk(inFile string, files []*msx.File, autoexec bool) {
+	dskFile := inFile + ".dsk"
+	if inFile == "-" {
+		dskFile = "stdin.dsk"
+	}
+
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintf(os.Stderr, "---- disk ----\n")
+	// the time of the tape: the same tape makes the same disk
+	stamp := msx.DOSEpoch
+	if fi, err := os.Stat(inFile); err == nil && inFile != "-" {
+		stamp = fi.ModTime()
+	}
+	disk := msx.NewDisk(stamp)
+	var names []string
+	var types []msx.FileType
+	for _, file := range files {
+		if file.Header == nil || file.Data == nil {
+			continue
+		}
+		data, err := file.DiskData()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%-12s error: %v\n", file.Name, err)
+			continue
+		}
+		name, err := disk.AddFile(msx.FileName(file.Name), file.Type.Ext(), data)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%-12s error: %v\n", file.Name, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%-12s %5d bytes\n", name, len(data))
+		names = append(names, name)
+		types = append(types, file.Type)
+	}
+	if autoexec && len(names) > 0 {
+		data := msx.Autoexec(names, types)
+		name, err := disk.AddFile("AUTOEXEC", "BAS", data)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(os.Stderr, "%-12s %5d bytes\n", name, len(data))
+	}
+
+	err := os.WriteFile(dskFile, disk.Bytes(), 0666)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(os.Stderr, "-> %s\n", dskFile)
+}
+
+func printListing(txt string) {
+	for _, l := range strings.SplitAfter(txt, "\n") {
+		if l != "" {
+			fmt.Fprintf(os.Stderr, "     > %s", l)
+		}
+	}
+}
+
+// writeListing writes the listing next to the file.
+func writeListing(path string, ext string, newExt string, txt string) {
+	if path == "" {
+		return
+	}
+	err := os.WriteFile(strings.TrimSuffix(path, ext)+newExt, []byte(txt), 0666)
+	if err != nil {
+		panic(err)
+	}
 }
 
 func bitToByte(bits []byte) ([]byte, error) {
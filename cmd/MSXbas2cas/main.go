@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ysh86/CMTtools/dac"
+	"github.com/ysh86/CMTtools/msx"
+)
+
+func main() {
+	var inFile string
+	var outFile string
+	var name string
+	var wavFile string
+	var baud int
+
+	flag.StringVar(&inFile, "infile", "-", "BASIC text file to read")
+	flag.StringVar(&outFile, "outfile", "", "cas file to write (default: infile.cas)")
+	flag.StringVar(&name, "name", "", "file name on tape (default: infile)")
+	flag.StringVar(&wavFile, "wav", "", "wav file to write, empty for none")
+	flag.IntVar(&baud, "baud", 1200, "wav: baud rate: 1200 or 2400")
+	flag.Parse()
+	if len(flag.Args()) == 1 {
+		inFile = flag.Arg(0)
+	}
+
+	// in
+	var err error
+	var f *os.File
+	if inFile == "-" {
+		f = os.Stdin
+		if outFile == "" {
+			outFile = "stdin.cas"
+		}
+	} else {
+		f, err = os.Open(inFile)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		if outFile == "" {
+			outFile = inFile + ".cas"
+		}
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(inFile), filepath.Ext(inFile))
+		}
+	}
+	name = strings.ToUpper(name)
+	if len(name) > msx.NameLen {
+		name = name[0:msx.NameLen]
+	}
+
+	// step1: text to lines
+	var lines []msx.Line
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		text := strings.TrimRight(scanner.Text(), " \r")
+		if text == "" {
+			continue
+		}
+		line, err := msx.TokenizeLine(text)
+		if err != nil {
+			panic(err)
+		}
+		if len(lines) != 0 && line.Number <= lines[len(lines)-1].Number {
+			panic(fmt.Errorf("line %d: not in ascending order", line.Number))
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		panic(err)
+	}
+
+	// step2: lines to blocks
+	data, err := msx.Program(lines, msx.BASICStart)
+	if err != nil {
+		panic(err)
+	}
+	file := &msx.File{
+		Header: &msx.Header{Type: msx.TypeBASIC, Name: name},
+		Data:   data,
+	}
+	blocks := file.Blocks()
+	fmt.Fprintf(os.Stderr, "lines:   %d\n", len(lines))
+	fmt.Fprintf(os.Stderr, "name:    %s\n", file.Name)
+	fmt.Fprintf(os.Stderr, "dataLen: %04x\n", len(data))
+	fmt.Fprintf(os.Stderr, "address: %04x - %04x\n", msx.BASICStart, msx.BASICStart+len(data)-1)
+
+	// step3: blocks to cas
+	fcas, err := os.Create(outFile)
+	if err != nil {
+		panic(err)
+	}
+	defer fcas.Close()
+	cas := msx.NewCASWriter(fcas)
+	for _, b := range blocks {
+		err := cas.StartBlock()
+		if err != nil {
+			panic(err)
+		}
+		_, err = cas.Write(b)
+		if err != nil {
+			panic(err)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "-> %s\n", outFile)
+
+	// step4: blocks to wav
+	if wavFile == "" {
+		return
+	}
+	fwav, err := os.Create(wavFile)
+	if err != nil {
+		panic(err)
+	}
+	defer fwav.Close()
+	err = dac.KCSBits2wav(fwav, msx.TapeBits(blocks, baud), baud, &dac.DefaultFormat)
+	if err != nil {
+		panic(err)
+	}
+	fmt.Fprintf(os.Stderr, "-> %s\n", wavFile)
+}
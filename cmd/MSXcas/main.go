@@ -0,0 +1,208 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/ysh86/CMTtools/msx"
+)
+
+const usage = `usage: MSXcas [flags] command file.cas [args]
+
+commands:
+  list     file.cas              list the files
+  extract  file.cas NAME|NO      write the data: NAME.bas/.asc/.bin
+  add      file.cas files...     append raw files with the header blocks
+  delete   file.cas NAME|NO      remove a file
+  move     file.cas NAME|NO NO   move a file to the position
+  validate file.cas              check the alignment and the files
+
+flags:
+`
+
+func main() {
+	outFile := flag.String("outfile", "", "extract: file to write, add/delete/move: .cas to write (default: in place)")
+	typeName := flag.String("type", "", "add: file type: bas, asc or bin (default: by the extension)")
+	name := flag.String("name", "", "add: file name on tape (default: file name)")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	cmd, casFile, args := flag.Arg(0), flag.Arg(1), flag.Args()[2:]
+
+	data, err := os.ReadFile(casFile)
+	if err != nil {
+		if cmd != "add" || !os.IsNotExist(err) {
+			panic(err)
+		}
+		// new .cas
+		data = nil
+	}
+	if cmd == "validate" {
+		errs := msx.ValidateCAS(data)
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "%v\n", e)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "ok\n")
+		return
+	}
+	cas := &msx.CAS{}
+	if data != nil {
+		cas, err = msx.ReadCAS(data)
+		if err != nil {
+			panic(fmt.Errorf("%s: %w", casFile, err))
+		}
+	}
+
+	switch cmd {
+	case "list":
+		list(cas)
+		return
+	case "extract":
+		if len(args) != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		file := cas.Files[find(cas, args[0])]
+		if file.Header == nil || file.Data == nil {
+			panic(fmt.Errorf("%s: no data", args[0]))
+		}
+		path := *outFile
+		if path == "" {
+			path = strings.TrimRight(file.Name, " ") + file.Type.Ext()
+		}
+		err := os.WriteFile(path, file.Data, 0666)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(os.Stderr, "%s %5d bytes -> %s\n", file.Name, len(file.Data), path)
+		return
+	case "add":
+		if len(args) == 0 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		for _, path := range args {
+			cas.Add(rawFile(path, *typeName, *name, len(args) > 1))
+		}
+	case "delete":
+		if len(args) != 1 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		err := cas.Delete(find(cas, args[0]))
+		if err != nil {
+			panic(err)
+		}
+	case "move":
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		to, err := strconv.Atoi(args[1])
+		if err != nil {
+			panic(err)
+		}
+		err = cas.Move(find(cas, args[0]), to)
+		if err != nil {
+			panic(err)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// write back
+	if *outFile == "" {
+		*outFile = casFile
+	}
+	err = os.WriteFile(*outFile, cas.Bytes(), 0666)
+	if err != nil {
+		panic(err)
+	}
+	list(cas)
+	fmt.Fprintf(os.Stderr, "-> %s\n", *outFile)
+}
+
+func list(cas *msx.CAS) {
+	for i, file := range cas.Files {
+		if file.Header == nil {
+			fmt.Fprintf(os.Stderr, "%2d: %-6s %-6s %5d bytes: no header\n", i, "-", "", len(file.Data))
+			continue
+		}
+		if file.Data == nil {
+			fmt.Fprintf(os.Stderr, "%2d: %-6s %-6s %5s: no data\n", i, file.Type, file.Name, "")
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%2d: %-6s %-6s %5d bytes", i, file.Type, file.Name, len(file.Data))
+		if file.Type == msx.TypeBinary {
+			h, _, err := msx.ParseBinary(file.Data)
+			if err == nil {
+				fmt.Fprintf(os.Stderr, " %s", h)
+			}
+		}
+		fmt.Fprintln(os.Stderr, "")
+	}
+}
+
+// find returns the index of the file by the name or the number.
+func find(cas *msx.CAS, s string) int {
+	if i := cas.Find(s); i >= 0 {
+		return i
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil || i < 0 || len(cas.Files) <= i {
+		panic(fmt.Errorf("no file: %s", s))
+	}
+	return i
+}
+
+// rawFile reads a file extracted by MSX2bin or MSXcas.
+func rawFile(path string, typeName string, name string, multi bool) *msx.File {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		panic(err)
+	}
+	if typeName == "" {
+		typeName = filepath.Ext(path)
+	}
+	fileType, err := msx.ParseFileType(typeName)
+	if err != nil {
+		panic(fmt.Errorf("%s: %w", path, err))
+	}
+	if fileType == msx.TypeBASIC && len(data) > 0 && data[0] == 0xff {
+		// saved to disk
+		data = data[1:]
+	}
+	if fileType == msx.TypeBinary {
+		// saved to disk: 0xFE is stripped
+		h, code, err := msx.ParseBinary(data)
+		if err != nil {
+			panic(fmt.Errorf("%s: %w", path, err))
+		}
+		data = append([]byte{
+			byte(h.Start), byte(h.Start >> 8),
+			byte(h.End), byte(h.End >> 8),
+			byte(h.Exec), byte(h.Exec >> 8),
+		}, code...)
+	}
+	if name == "" || multi {
+		name = msx.TapeName(path)
+	}
+	return &msx.File{
+		Header: &msx.Header{Type: fileType, Name: name},
+		Data:   data,
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"flag"
 	"fmt"
@@ -72,7 +73,8 @@ func main() {
 	// step1: wav to bits
 	rbits, wbits := io.Pipe()
 	defer rbits.Close()
-	adConverter.KCSWav2bits(wbits, f)
+	log := adConverter.KCSWav2bits(wbits, f)
+	rb := adConverter.NewBitCounter(rbits)
 
 	// step2: bits to bytes
 	errc := make(chan interface{})
@@ -85,7 +87,7 @@ func main() {
 	LOOP:
 		// skip start code
 		for {
-			_, err := io.ReadFull(rbits, bits[0:1])
+			_, err := io.ReadFull(rb, bits[0:1])
 			if err != nil {
 				panic(err)
 			}
@@ -97,29 +99,62 @@ func main() {
 		fmt.Printf("---- start ----\n")
 		fmt.Printf("start ones: %d\n", countOnes)
 
-		_, err := io.ReadFull(rbits, bits[1:])
+		_, err := io.ReadFull(rb, bits[1:])
 		if err != nil {
 			panic(err)
 		}
 
 		pos := 0
 		for {
-			data, err := bitToByte(bits[:])
-			if err == io.EOF {
-				countOnes = 11
-				fmt.Printf("EOF pos: %04x\n", pos)
-				goto LOOP
-			}
-			if err != nil {
-				panic(err)
+			// demodulation errors in the bits of the byte
+			errs := log.Errors(rb.Pos()-int64(len(bits)), rb.Pos())
+			var data []byte
+			framed := true
+			if len(errs) > 0 && bytes.IndexByte(bits[:], 0) >= 0 {
+				// keep the byte even if the frame is broken, all ones are the end of the block
+				var b byte
+				b, framed = adConverter.KCSFrame(bits[:])
+				if bits[0] == 0 {
+					data = []byte{b}
+					for _, e := range errs {
+						fmt.Printf("suspect: %04x: %02x: %v (sample %d)\n", pos, b, e.Err, e.Sample)
+					}
+					if !framed {
+						fmt.Printf("suspect: %04x: %02x: broken frame, resync\n", pos, b)
+					}
+				} else {
+					// re-framed by resync
+					fmt.Printf("suspect: %04x: no start bit: %v (sample %d), resync\n", pos, errs[0].Err, errs[0].Sample)
+				}
+			} else {
+				data, err = bitToByte(bits[:])
+				if err == io.EOF {
+					countOnes = 11
+					fmt.Printf("EOF pos: %04x\n", pos)
+					goto LOOP
+				}
+				if err != nil {
+					panic(err)
+				}
 			}
 			// output
-			fw.Write(data)
-			//fmt.Printf("%04x: %02x\n", pos, data[0])
-			pos++
+			if data != nil {
+				fw.Write(data)
+				//fmt.Printf("%04x: %02x\n", pos, data[0])
+				pos++
+			}
 
 			// next
-			_, err = io.ReadFull(rbits, bits[:])
+			if framed {
+				_, err = io.ReadFull(rb, bits[:])
+			} else {
+				err = adConverter.KCSResync(rb, bits[:])
+				if err == adConverter.ErrEndOfBlock {
+					countOnes = 11
+					fmt.Printf("EOF pos: %04x\n", pos)
+					goto LOOP
+				}
+			}
 			if err == io.EOF {
 				fmt.Printf("EOF pos: %04x\n", pos)
 				fmt.Printf("---- EOF ----\n")
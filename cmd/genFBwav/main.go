@@ -2,97 +2,174 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"io"
 	"os"
-
-	"github.com/youpy/go-wav"
+	"strings"
 
 	adConverter "github.com/ysh86/CMTtools/adc"
+	"github.com/ysh86/CMTtools/dac"
+	"github.com/ysh86/CMTtools/fb"
 )
 
 func main() {
-	inFile := flag.String("infile", "", "trace log to convert")
+	inFile := flag.String("infile", "", "trace log or binary files to convert")
+	outFile := flag.String("outfile", "", "wav file to write, - for stdout (default: infile.wav)")
+	binMode := flag.Bool("bin", false, "infiles are payloads of data blocks (default for *.bin)")
+	cycles := flag.Bool("cycles", false, "trace: render the writes to $4016 by the CPU cycle counts")
+	mask := flag.Uint("mask", 0x02, "cycles: bit of $4016 to the data recorder")
+	clock := flag.Float64("clock", dac.NESClock, "cycles: CPU clock [Hz]")
+	attrib := flag.Int("attrib", -1, "bin: attribute (default: BASIC code or BG GRAPHIC by the data)")
+	name := flag.String("name", "", "bin: file name on tape (default: infile)")
+	loadAddr := flag.Uint("load", 0x6006, "bin: load address")
+	callAddr := flag.Uint("call", 0x0000, "bin: call address")
+	rate := flag.Uint("rate", 48000, "sample rate: 44100, 48000 or 96000")
+	depth := flag.Uint("bits", 8, "bits/sample: 8 or 16")
+	stereo := flag.Bool("stereo", false, "output 2ch")
+	amp := flag.Float64("amp", 1.0, "amplitude: 0.0 - 1.0")
+	shapeName := flag.String("shape", "square", "waveform: square, sine or bandlimited")
 	flag.Parse()
-	if len(os.Args) == 2 {
-		inFile = &os.Args[1]
+	inFiles := flag.Args()
+	if len(inFiles) == 0 {
+		inFiles = []string{*inFile}
+	}
+	if strings.HasSuffix(inFiles[0], ".bin") {
+		*binMode = true
+	}
+
+	// out format
+	shape, err := dac.ParseShape(*shapeName)
+	if err != nil {
+		panic(err)
+	}
+	format := dac.Format{
+		SampleRate:    uint32(*rate),
+		BitsPerSample: uint16(*depth),
+		NumChannels:   1,
+		Amplitude:     *amp,
+		Shape:         shape,
+	}
+	if *stereo {
+		format.NumChannels = 2
+	}
+	err = format.Validate()
+	if err != nil {
+		panic(err)
 	}
 
-	// in
-	var err error
+	// out
+	if *outFile == "" {
+		*outFile = inFiles[0] + ".wav"
+		if inFiles[0] == "-" {
+			*outFile = "stdin.wav"
+		}
+	}
+	var fwav *os.File
+	if *outFile == "-" {
+		fwav = os.Stdout
+	} else {
+		fwav, err = os.Create(*outFile)
+		if err != nil {
+			panic(err)
+		}
+		defer fwav.Close()
+	}
+
+	// step1: trace log or binary files to bits
+	if *binMode {
+		rbits, wbits := io.Pipe()
+		defer rbits.Close()
+		go func() {
+			defer wbits.Close()
+			for i, inFile := range inFiles {
+				data, err := os.ReadFile(inFile)
+				if err != nil {
+					panic(err)
+				}
+				if len(data) > 0xffff {
+					panic(fmt.Errorf("%s: too large: %d", inFile, len(data)))
+				}
+				info := fb.Info{
+					Attrib:   byte(*attrib),
+					Name:     *name,
+					DataLen:  uint16(len(data)),
+					LoadAddr: uint16(*loadAddr),
+					CallAddr: uint16(*callAddr),
+				}
+				if *attrib < 0 {
+					info.Attrib = guessAttrib(data)
+				}
+				if info.Name == "" || len(inFiles) > 1 {
+					info.Name = fb.TapeName(inFile)
+				}
+				bits, err := fb.TapeBits(&info, data)
+				if err != nil {
+					panic(err)
+				}
+				fmt.Fprintf(os.Stderr, "%2d: %-16s attrib:%02x dataLen:%04x loadAddr:%04x callAddr:%04x checksum:%04x\n",
+					i, info.Name, info.Attrib, info.DataLen, info.LoadAddr, info.CallAddr, fb.Checksum(data))
+				_, err = wbits.Write(bits)
+				if err != nil {
+					panic(err)
+				}
+			}
+		}()
+
+		// step2: bits to wav while converting the files
+		err = dac.FBStream2wav(fwav, rbits, &format)
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// trace log
 	var f *os.File
-	outFile := *inFile + ".wav"
-	if *inFile == "-" {
+	if inFiles[0] == "-" {
 		f = os.Stdin
-		outFile = "stdin.wav"
 	} else {
-		f, err = os.Open(*inFile)
+		f, err = os.Open(inFiles[0])
 		if err != nil {
 			panic(err)
 		}
 		defer f.Close()
 	}
+	if *cycles {
+		writes := make(chan adConverter.PortWrite, 1024)
+		adConverter.FBPort2writes(writes, f)
+		edges := make(chan dac.Edge, 1024)
+		go func() {
+			defer close(edges)
+			for w := range writes {
+				edges <- dac.Edge{Cycle: w.Cycle, High: uint(w.Value)&*mask != 0}
+			}
+		}()
 
-	// out
-	fwav, err := os.Create(outFile)
-	if err != nil {
-		panic(err)
+		// step2: edges to wav while reading the trace log
+		err = dac.Edges2wav(fwav, edges, *clock, &format)
+		if err != nil {
+			panic(err)
+		}
+		return
 	}
-	defer fwav.Close()
-
-	// step1: trace log to bits
 	rbits, wbits := io.Pipe()
 	defer rbits.Close()
 	adConverter.FBAsm2bits(wbits, f)
-	bits, err := io.ReadAll(rbits) // all on mem :)
+
+	// step2: bits to wav while reading the trace log
+	err = dac.FBStream2wav(fwav, rbits, &format)
 	if err != nil {
 		panic(err)
 	}
+}
 
-	// support 1ch, 48kHz, 8bit only
-	//
-	// wav parameters
-	//  Zero: short 12.5 samples x2 @ 48kHz = 1920 Hz
-	//  One:  long  25.0 samples x2 @ 48kHz = 960 Hz
-	//
-	nZERO := uint32(25)
-	ZERO := [25]wav.Sample{
-		{[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}},
-		{[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}},
-		{[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{0, 0}}, {[2]int{0, 0}},
-		{[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}},
-		{[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}},
-	}
-	nONE := uint32(50)
-	ONE := [50]wav.Sample{
-		{[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}},
-		{[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}},
-		{[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}},
-		{[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}},
-		{[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}}, {[2]int{255, 255}},
-		{[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}},
-		{[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}},
-		{[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}},
-		{[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}},
-		{[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}}, {[2]int{0, 0}},
-	}
-
-	// step2: count LPCM samples
-	numSamples := uint32(0)
-	for _, b := range bits {
-		if b == 0 {
-			numSamples += nZERO
-		} else {
-			numSamples += nONE
-		}
+// guessAttrib returns the attribute by the data.
+func guessAttrib(data []byte) byte {
+	if _, err := fb.ParseProgram(data); err == nil {
+		return fb.AttribBASIC
 	}
-	writer := wav.NewWriter(fwav, numSamples, 1, 48000, 8)
-
-	// step3: bits to wav
-	for _, b := range bits {
-		if b == 0 {
-			writer.WriteSamples(ZERO[:])
-		} else {
-			writer.WriteSamples(ONE[:])
-		}
+	if len(data) == fb.BGLen {
+		return fb.AttribBG
 	}
+	return fb.AttribBASIC
 }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ysh86/CMTtools/dac"
+	"github.com/ysh86/CMTtools/msx"
+)
+
+func main() {
+	inFile := flag.String("infile", "", ".cas file or raw files to convert")
+	outFile := flag.String("outfile", "", "wav file to write, - for stdout (default: infile.wav)")
+	typeName := flag.String("type", "", "raw: file type: bas, asc or bin (default: by the extension)")
+	name := flag.String("name", "", "raw: file name on tape (default: infile)")
+	baud := flag.Int("baud", 1200, "baud rate: 1200 or 2400")
+	rate := flag.Uint("rate", 48000, "sample rate: 44100, 48000 or 96000")
+	depth := flag.Uint("bits", 8, "bits/sample: 8 or 16")
+	stereo := flag.Bool("stereo", false, "output 2ch")
+	amp := flag.Float64("amp", 1.0, "amplitude: 0.0 - 1.0")
+	shapeName := flag.String("shape", "square", "waveform: square, sine or bandlimited")
+	flag.Parse()
+	inFiles := flag.Args()
+	if len(inFiles) == 0 {
+		inFiles = []string{*inFile}
+	}
+
+	// out format
+	shape, err := dac.ParseShape(*shapeName)
+	if err != nil {
+		panic(err)
+	}
+	format := dac.Format{
+		SampleRate:    uint32(*rate),
+		BitsPerSample: uint16(*depth),
+		NumChannels:   1,
+		Amplitude:     *amp,
+		Shape:         shape,
+	}
+	if *stereo {
+		format.NumChannels = 2
+	}
+	err = format.Validate()
+	if err != nil {
+		panic(err)
+	}
+
+	// step1: .cas or raw files to blocks
+	var blocks [][]byte
+	for _, inFile := range inFiles {
+		data, err := os.ReadFile(inFile)
+		if err != nil {
+			panic(err)
+		}
+		if strings.EqualFold(filepath.Ext(inFile), ".cas") {
+			b := msx.SplitCAS(data)
+			if len(b) == 0 {
+				panic(fmt.Errorf("%s: no CAS header", inFile))
+			}
+			blocks = append(blocks, b...)
+			continue
+		}
+
+		t := *typeName
+		if t == "" {
+			t = filepath.Ext(inFile)
+		}
+		fileType, err := msx.ParseFileType(t)
+		if err != nil {
+			panic(fmt.Errorf("%s: %w", inFile, err))
+		}
+		if fileType == msx.TypeBASIC && len(data) > 0 && data[0] == 0xff {
+			// saved to disk
+			data = data[1:]
+		}
+		file := &msx.File{
+			Header: &msx.Header{Type: fileType, Name: *name},
+			Data:   data,
+		}
+		if file.Name == "" || len(inFiles) > 1 {
+			file.Name = msx.TapeName(inFile)
+		}
+		blocks = append(blocks, file.Blocks()...)
+	}
+	for i, file := range msx.Files(blocks) {
+		if file.Header == nil {
+			fmt.Fprintf(os.Stderr, "%2d: %-6s %-6s %5d bytes: no header\n", i, "-", "", len(file.Data))
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%2d: %-6s %-6s %5d bytes\n", i, file.Type, file.Name, len(file.Data))
+	}
+
+	// out
+	if *outFile == "" {
+		*outFile = inFiles[0] + ".wav"
+	}
+	fwav := os.Stdout
+	if *outFile != "-" {
+		fwav, err = os.Create(*outFile)
+		if err != nil {
+			panic(err)
+		}
+		defer fwav.Close()
+	}
+
+	// step2: blocks to wav
+	err = dac.KCSBits2wav(fwav, msx.TapeBits(blocks, *baud), *baud, &format)
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,2 @@
+// D/A Converter
+package dac
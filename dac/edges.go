@@ -0,0 +1,77 @@
+package dac
+
+import (
+	"io"
+
+	"github.com/youpy/go-wav"
+)
+
+// NES CPU clock (NTSC)
+const NESClock = 1789773.0
+
+// Edge is a change of the output level at the CPU cycle.
+type Edge struct {
+	Cycle int64
+	High  bool
+}
+
+// Edges2wav writes the levels between the edges as a wav file.
+// The timing is kept at the sub-sample precision: each sample is the average level in its period.
+// Format.Shape is not used, the waveform is the real one.
+func Edges2wav(w io.Writer, edges <-chan Edge, clock float64, format *Format) error {
+	sw, err := NewStreamWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	cyclesPerSample := clock / float64(format.SampleRate)
+	emit := func(highCycles float64) error {
+		v := 2*highCycles/cyclesPerSample - 1
+		return sw.WriteSamples([]wav.Sample{format.sample(v)})
+	}
+
+	start := int64(-1)
+	high := false
+	pos := 0.0  // start of the current sample [cycles]
+	last := 0.0 // last edge [cycles]
+	acc := 0.0  // high period in the current sample [cycles]
+	for e := range edges {
+		if start < 0 {
+			// the 1st edge is the origin
+			start = e.Cycle
+		}
+		t := float64(e.Cycle - start)
+
+		// samples until the edge
+		for pos+cyclesPerSample <= t {
+			end := pos + cyclesPerSample
+			if high {
+				acc += end - last
+			}
+			err := emit(acc)
+			if err != nil {
+				return err
+			}
+			pos = end
+			last = end
+			acc = 0
+		}
+
+		// the edge in the current sample
+		if high {
+			acc += t - last
+		}
+		last = t
+		high = e.High
+	}
+
+	// the last sample
+	if high {
+		acc += pos + cyclesPerSample - last
+	}
+	err = emit(acc)
+	if err != nil {
+		return err
+	}
+	return sw.Close()
+}
@@ -0,0 +1,38 @@
+package dac
+
+import (
+	"io"
+)
+
+// wav parameters
+//
+//	Zero: 1920 Hz (12.5 samples x2 @ 48kHz)
+//	One:   960 Hz (25.0 samples x2 @ 48kHz)
+const (
+	FBZeroHz = 1920
+	FBOneHz  = 960
+)
+
+func fbHz(b byte) float64 {
+	if b == 0 {
+		return FBZeroHz
+	}
+	return FBOneHz
+}
+
+// FBBits2wav writes the bits of FB CMT as a wav file.
+func FBBits2wav(w io.Writer, bits []byte, format *Format) error {
+	sw, err := NewStreamWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	s := &synth{format: format}
+	for _, b := range bits {
+		err := sw.WriteSamples(s.cycle(fbHz(b)))
+		if err != nil {
+			return err
+		}
+	}
+	return sw.Close()
+}
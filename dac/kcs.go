@@ -0,0 +1,44 @@
+package dac
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/youpy/go-wav"
+)
+
+// KCS(MSX) wav parameters
+//
+//	1200 baud: Zero 1200 Hz x1, One 2400 Hz x2
+//	2400 baud: Zero 2400 Hz x1, One 4800 Hz x2
+//
+// The bits other than 0 and 1 are silence of the bit period.
+func kcsBit(s *synth, b byte, baud int) []wav.Sample {
+	switch b {
+	case 0:
+		return s.cycle(float64(baud))
+	case 1:
+		return append(s.cycle(float64(baud*2)), s.cycle(float64(baud*2))...)
+	}
+	return s.rest(float64(baud))
+}
+
+// KCSBits2wav writes the bits of MSX CMT as a wav file.
+func KCSBits2wav(w io.Writer, bits []byte, baud int, format *Format) error {
+	if baud != 1200 && baud != 2400 {
+		return fmt.Errorf("invalid baud rate: %d", baud)
+	}
+	sw, err := NewStreamWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	s := &synth{format: format}
+	for _, b := range bits {
+		err := sw.WriteSamples(kcsBit(s, b, baud))
+		if err != nil {
+			return err
+		}
+	}
+	return sw.Close()
+}
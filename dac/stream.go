@@ -0,0 +1,157 @@
+package dac
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/youpy/go-wav"
+)
+
+// unknown length of RIFF and data chunks.
+// Same as the other tools (ffmpeg, sox) for the output to pipes.
+const unknownSize = 0xffffffff
+
+const headerSize = 44
+
+// StreamWriter writes a wav file without the number of samples in advance.
+//
+// If the output is seekable, the sizes of RIFF and data chunks are patched by Close.
+// Otherwise, they remain 0xFFFFFFFF (unknown length).
+type StreamWriter struct {
+	w        io.Writer
+	bw       *bufio.Writer
+	format   *Format
+	dataSize int64
+}
+
+// NewStreamWriter writes the wav header.
+func NewStreamWriter(w io.Writer, format *Format) (*StreamWriter, error) {
+	err := format.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	sw := &StreamWriter{
+		w:      w,
+		bw:     bufio.NewWriterSize(w, 64*1024),
+		format: format,
+	}
+	err = sw.writeHeader(unknownSize, unknownSize)
+	if err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+func (sw *StreamWriter) writeHeader(riffSize, dataSize uint32) error {
+	blockAlign := sw.format.NumChannels * sw.format.BitsPerSample / 8
+	header := struct {
+		RIFF     [4]byte
+		RIFFSize uint32
+		WAVE     [4]byte
+		FMT      [4]byte
+		FMTSize  uint32
+		wav.WavFormat
+		DATA     [4]byte
+		DataSize uint32
+	}{
+		RIFF:     [4]byte{'R', 'I', 'F', 'F'},
+		RIFFSize: riffSize,
+		WAVE:     [4]byte{'W', 'A', 'V', 'E'},
+		FMT:      [4]byte{'f', 'm', 't', ' '},
+		FMTSize:  16,
+		WavFormat: wav.WavFormat{
+			AudioFormat:   wav.AudioFormatPCM,
+			NumChannels:   sw.format.NumChannels,
+			SampleRate:    sw.format.SampleRate,
+			ByteRate:      sw.format.SampleRate * uint32(blockAlign),
+			BlockAlign:    blockAlign,
+			BitsPerSample: sw.format.BitsPerSample,
+		},
+		DATA:     [4]byte{'d', 'a', 't', 'a'},
+		DataSize: dataSize,
+	}
+	return binary.Write(sw.bw, binary.LittleEndian, &header)
+}
+
+// WriteSamples writes LPCM samples.
+func (sw *StreamWriter) WriteSamples(samples []wav.Sample) error {
+	for _, s := range samples {
+		for ch := 0; ch < int(sw.format.NumChannels); ch++ {
+			v := s.Values[ch]
+			var err error
+			if sw.format.BitsPerSample == 8 {
+				err = sw.bw.WriteByte(byte(v))
+			} else {
+				_, err = sw.bw.Write([]byte{byte(v), byte(v >> 8)})
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	sw.dataSize += int64(len(samples)) * int64(sw.format.NumChannels*sw.format.BitsPerSample/8)
+	return nil
+}
+
+// Close flushes the samples and patches the header if possible.
+// It doesn't close the underlying writer.
+func (sw *StreamWriter) Close() error {
+	err := sw.bw.Flush()
+	if err != nil {
+		return err
+	}
+
+	ws, ok := sw.w.(io.WriteSeeker)
+	if !ok || sw.dataSize+headerSize-8 >= unknownSize {
+		return nil
+	}
+	end, err := ws.Seek(0, io.SeekCurrent)
+	if err != nil {
+		// pipe
+		return nil
+	}
+	_, err = ws.Seek(end-sw.dataSize-headerSize, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	sw.bw.Reset(ws)
+	err = sw.writeHeader(uint32(sw.dataSize+headerSize-8), uint32(sw.dataSize))
+	if err != nil {
+		return err
+	}
+	err = sw.bw.Flush()
+	if err != nil {
+		return err
+	}
+	_, err = ws.Seek(end, io.SeekStart)
+	return err
+}
+
+// FBStream2wav writes the bits of FB CMT as a wav file while reading them.
+func FBStream2wav(w io.Writer, rbits io.Reader, format *Format) error {
+	sw, err := NewStreamWriter(w, format)
+	if err != nil {
+		return err
+	}
+
+	s := &synth{format: format}
+	var bits [1024]byte
+	for {
+		n, err := rbits.Read(bits[:])
+		for _, b := range bits[0:n] {
+			err := sw.WriteSamples(s.cycle(fbHz(b)))
+			if err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return sw.Close()
+}
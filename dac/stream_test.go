@@ -0,0 +1,136 @@
+package dac
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/youpy/go-wav"
+)
+
+// seekBuffer is an io.WriteSeeker on memory.
+type seekBuffer struct {
+	buf []byte
+	pos int
+}
+
+func (b *seekBuffer) Write(p []byte) (int, error) {
+	if n := b.pos + len(p); n > len(b.buf) {
+		b.buf = append(b.buf, make([]byte, n-len(b.buf))...)
+	}
+	b.pos += copy(b.buf[b.pos:], p)
+	return len(p), nil
+}
+
+func (b *seekBuffer) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += int64(b.pos)
+	case io.SeekEnd:
+		offset += int64(len(b.buf))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	b.pos = int(offset)
+	return offset, nil
+}
+
+// sizes returns the sizes of RIFF and data chunks.
+func sizes(t *testing.T, b []byte) (uint32, uint32) {
+	t.Helper()
+	if len(b) < headerSize || string(b[0:4]) != "RIFF" || string(b[8:16]) != "WAVEfmt " || string(b[36:40]) != "data" {
+		t.Fatalf("invalid header: % x", b[0:min(len(b), headerSize)])
+	}
+	return binary.LittleEndian.Uint32(b[4:8]), binary.LittleEndian.Uint32(b[40:44])
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func TestStreamWriter(t *testing.T) {
+	format := DefaultFormat
+	format.BitsPerSample = 16
+	format.NumChannels = 2
+	samples := make([]wav.Sample, 100)
+
+	// seekable: the sizes are patched
+	sb := &seekBuffer{}
+	sw, err := NewStreamWriter(sb, &format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := sw.WriteSamples(samples); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(sb.buf) != headerSize+300*4 || sb.pos != len(sb.buf) {
+		t.Fatalf("length %d, position %d", len(sb.buf), sb.pos)
+	}
+	riff, data := sizes(t, sb.buf)
+	if riff != uint32(len(sb.buf)-8) || data != 300*4 {
+		t.Errorf("seeker: RIFF %d, data %d", riff, data)
+	}
+
+	// pipe: unknown sizes
+	var buf bytes.Buffer
+	sw, err = NewStreamWriter(&buf, &format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.WriteSamples(samples); err != nil {
+		t.Fatal(err)
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	riff, data = sizes(t, buf.Bytes())
+	if riff != unknownSize || data != unknownSize || buf.Len() != headerSize+100*4 {
+		t.Errorf("writer: RIFF %x, data %x, length %d", riff, data, buf.Len())
+	}
+	if !bytes.Equal(buf.Bytes()[headerSize:], sb.buf[headerSize:headerSize+100*4]) {
+		t.Errorf("writer: samples differ")
+	}
+
+	format.BitsPerSample = 12
+	if _, err := NewStreamWriter(&buf, &format); err == nil {
+		t.Errorf("bits/sample: no error")
+	}
+}
+
+func TestKCSBits2wav(t *testing.T) {
+	// 1200 baud at 48kHz: 40 samples per bit
+	sb := &seekBuffer{}
+	if err := KCSBits2wav(sb, []byte{0, 1, 2}, 1200, &DefaultFormat); err != nil {
+		t.Fatal(err)
+	}
+	riff, data := sizes(t, sb.buf)
+	if data != 3*40 || riff != data+headerSize-8 || len(sb.buf) != headerSize+3*40 {
+		t.Fatalf("RIFF %d, data %d, length %d", riff, data, len(sb.buf))
+	}
+	samples := sb.buf[headerSize:]
+	// 0: 1200 Hz x1, 1: 2400 Hz x2, silence
+	for _, tt := range []struct {
+		i    int
+		want byte
+	}{{0, 0xff}, {19, 0xff}, {20, 0x00}, {39, 0x00}, {40, 0xff}, {50, 0x00}, {60, 0xff}, {70, 0x00}, {80, 0x80}, {119, 0x80}} {
+		if got := samples[tt.i]; got != tt.want {
+			t.Errorf("sample %d: got %02x, want %02x", tt.i, got, tt.want)
+		}
+	}
+
+	if err := KCSBits2wav(sb, nil, 300, &DefaultFormat); err == nil {
+		t.Errorf("baud: no error")
+	}
+}
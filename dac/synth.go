@@ -0,0 +1,140 @@
+package dac
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/youpy/go-wav"
+)
+
+// Shape of the waveform
+type Shape int
+
+const (
+	Square Shape = iota
+	Sine
+	BandLimited // square wave without harmonics over the Nyquist frequency
+)
+
+// ParseShape parses "square", "sine" or "bandlimited".
+func ParseShape(s string) (Shape, error) {
+	switch s {
+	case "square":
+		return Square, nil
+	case "sine":
+		return Sine, nil
+	case "bandlimited":
+		return BandLimited, nil
+	}
+	return Square, fmt.Errorf("unknown shape: %s", s)
+}
+
+// Format of the output wav
+type Format struct {
+	SampleRate    uint32
+	BitsPerSample uint16 // 8 or 16
+	NumChannels   uint16 // 1 or 2
+	Amplitude     float64
+	Shape         Shape
+}
+
+// DefaultFormat is 1ch, 48kHz, 8bit square wave.
+var DefaultFormat = Format{
+	SampleRate:    48000,
+	BitsPerSample: 8,
+	NumChannels:   1,
+	Amplitude:     1.0,
+	Shape:         Square,
+}
+
+// Validate checks the parameters.
+func (f *Format) Validate() error {
+	if f.SampleRate < 8000 {
+		return fmt.Errorf("invalid sample rate: %d", f.SampleRate)
+	}
+	if f.BitsPerSample != 8 && f.BitsPerSample != 16 {
+		return fmt.Errorf("invalid bits/sample: %d", f.BitsPerSample)
+	}
+	if f.NumChannels != 1 && f.NumChannels != 2 {
+		return fmt.Errorf("invalid channels: %d", f.NumChannels)
+	}
+	if f.Amplitude <= 0 || 1 < f.Amplitude {
+		return fmt.Errorf("invalid amplitude: %v", f.Amplitude)
+	}
+	return nil
+}
+
+// sample converts v (-1.0 - 1.0) to LPCM.
+func (f *Format) sample(v float64) wav.Sample {
+	v = math.Max(-1, math.Min(1, v)) * f.Amplitude
+	var i int
+	if f.BitsPerSample == 8 {
+		i = int(math.Round(127.5 + 127.5*v))
+	} else {
+		i = int(math.Round(32767 * v))
+	}
+	return wav.Sample{Values: [2]int{i, i}}
+}
+
+// value of the waveform at the phase (0.0 - 1.0): high half, then low half
+func (f *Format) value(phase float64, hz float64) float64 {
+	switch f.Shape {
+	case Sine:
+		return math.Sin(2 * math.Pi * phase)
+	case BandLimited:
+		// Fourier series of the square wave: odd harmonics
+		v := 0.0
+		for k := 1; float64(k)*hz < float64(f.SampleRate)/2; k += 2 {
+			v += math.Sin(2*math.Pi*float64(k)*phase) / float64(k)
+		}
+		return v * 4 / math.Pi
+	}
+	if phase < 0.5 {
+		return 1
+	}
+	return -1
+}
+
+// synthesizer of cycles.
+// The length of a cycle is not an integer number of samples,
+// the fraction is carried over to the next cycle.
+type synth struct {
+	format *Format
+	pos    float64 // start of the next cycle [samples]
+	next   int64   // next sample
+}
+
+// cycle returns the samples of one cycle.
+func (s *synth) cycle(hz float64) []wav.Sample {
+	period := float64(s.format.SampleRate) / hz
+	end := s.pos + period
+	samples := make([]wav.Sample, 0, int(period)+1)
+	for ; float64(s.next) < end; s.next++ {
+		phase := (float64(s.next) - s.pos) / period
+		samples = append(samples, s.format.sample(s.format.value(phase, hz)))
+	}
+	s.pos = end
+	return samples
+}
+
+// skip is the same as cycle without the samples.
+func (s *synth) skip(hz float64) int {
+	period := float64(s.format.SampleRate) / hz
+	end := s.pos + period
+	n := 0
+	for ; float64(s.next) < end; s.next++ {
+		n++
+	}
+	s.pos = end
+	return n
+}
+
+// rest returns the samples of one cycle without the signal.
+func (s *synth) rest(hz float64) []wav.Sample {
+	n := s.skip(hz)
+	samples := make([]wav.Sample, n)
+	for i := range samples {
+		samples[i] = s.format.sample(0)
+	}
+	return samples
+}
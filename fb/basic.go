@@ -0,0 +1,149 @@
+package fb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// intermediate codes of FB V2/V3
+const (
+	codeEOL     = 0x00
+	codeLineNum = 0x0b // line number: 2 bytes
+	codeHex     = 0x11 // &H: 2 bytes
+	codeDec     = 0x12 // decimal: 2 bytes
+	codeQuote   = 0x22
+
+	tokenFirst = 0x80
+	tokenDATA  = 0x91
+	tokenREM   = 0x95
+)
+
+// keywords, operators and functions: 0x80 - 0xE7
+var tokens = [...]string{
+	// 0x80
+	"GOTO", "GOSUB", "RUN", "RETURN", "RESTORE", "THEN", "LIST", "SYSTEM",
+	"TO", "STEP", "SPRITE", "PRINT", "FOR", "NEXT", "PAUSE", "INPUT",
+	// 0x90
+	"LINPUT", "DATA", "IF", "READ", "DIM", "REM", "STOP", "CONT",
+	"CLS", "CLEAR", "ON", "OFF", "CUT", "NEW", "POKE", "CGSET",
+	// 0xA0
+	"VIEW", "MOVE", "END", "PLAY", "BEEP", "LOAD", "SAVE", "POSITION",
+	"KEY", "COLOR", "DEF", "CGEN", "SWAP", "CALL", "LOCATE", "PALET",
+	// 0xB0
+	"ERA", "TR", "FIND", "GAME", "BGTOOL", "AUTO", "DELETE", "RENUM",
+	"FILTER", "CLICK", "SCREEN", "BACKUP", "ERROR", "RESUME", "BGPUT", "BGGET",
+	// 0xC0
+	"CAN", "XOR", "OR", "AND", "NOT", "<>", ">=", "<=",
+	"=", ">", "<", "+", "-", "MOD", "/", "*",
+	// 0xD0
+	"ABS", "ASC", "STR$", "FRE", "LEN", "PEEK", "RND", "SGN",
+	"SPC", "TAB", "MID$", "STICK", "STRIG", "XPOS", "YPOS", "VAL",
+	// 0xE0
+	"POS", "CSRLIN", "CHR$", "HEX$", "INKEY$", "RIGHT$", "LEFT$", "SCR$",
+}
+
+// Line of a BASIC program.
+//
+//	length:  1 byte (length + number + body + EOL)
+//	number:  2 bytes
+//	body:    N bytes
+//	EOL:     0x00
+type Line struct {
+	Number uint16
+	Body   []byte
+}
+
+// ParseProgram splits BASIC code (attrib 0x02) into lines.
+// The program ends with 0x00.
+func ParseProgram(data []byte) ([]Line, error) {
+	var lines []Line
+	for len(data) > 0 {
+		length := int(data[0])
+		if length == 0 {
+			// end mark
+			return lines, nil
+		}
+		if length < 1+2+1 || len(data) < length {
+			return lines, fmt.Errorf("invalid line length: %d", length)
+		}
+		if data[length-1] != codeEOL {
+			return lines, fmt.Errorf("no EOL: %02x", data[length-1])
+		}
+		lines = append(lines, Line{
+			Number: uint16(data[1]) | uint16(data[2])<<8,
+			Body:   data[3 : length-1],
+		})
+		data = data[length:]
+	}
+	return lines, errors.New("no end mark")
+}
+
+// Detokenize converts the body of a line to text as it appears on screen.
+func Detokenize(body []byte) (string, error) {
+	var sb strings.Builder
+
+	inString := false
+	inData := false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == codeEOL {
+			break
+		}
+
+		// raw characters
+		if inString {
+			if c == codeQuote {
+				inString = false
+			}
+			sb.WriteString(CharToString(c))
+			continue
+		}
+		if inData && c != ':' {
+			if c == codeQuote {
+				inString = true
+			}
+			sb.WriteString(CharToString(c))
+			continue
+		}
+		inData = false
+
+		switch {
+		case c == codeLineNum || c == codeHex || c == codeDec:
+			if i+2 >= len(body) {
+				return sb.String(), fmt.Errorf("short operand: %02x", c)
+			}
+			v := uint16(body[i+1]) | uint16(body[i+2])<<8
+			i += 2
+			if c == codeHex {
+				fmt.Fprintf(&sb, "&H%X", v)
+			} else {
+				fmt.Fprintf(&sb, "%d", v)
+			}
+		case c == codeQuote:
+			inString = true
+			sb.WriteString(CharToString(c))
+		case c >= tokenFirst && int(c-tokenFirst) < len(tokens):
+			sb.WriteString(tokens[c-tokenFirst])
+			if c == tokenREM {
+				// comment
+				for _, r := range body[i+1:] {
+					if r == codeEOL {
+						break
+					}
+					sb.WriteString(CharToString(r))
+				}
+				return sb.String(), nil
+			}
+			if c == tokenDATA {
+				inData = true
+			}
+		case 0x20 <= c && c < 0x80:
+			sb.WriteString(CharToString(c))
+		default:
+			fmt.Fprintf(&sb, "{%02X}", c)
+		}
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,75 @@
+package fb
+
+import "testing"
+
+func TestDetokenize(t *testing.T) {
+	// every token alone
+	for i, want := range tokens {
+		got, err := Detokenize([]byte{byte(tokenFirst + i)})
+		if err != nil || got != want {
+			t.Errorf("%02x: got %q, %v, want %q", tokenFirst+i, got, err, want)
+		}
+	}
+
+	tests := []struct {
+		body []byte
+		want string
+	}{
+		{[]byte{0x80}, "GOTO"},
+		{[]byte{0x8b}, "PRINT"},
+		{[]byte{0xc8}, "="},
+		{[]byte{0xe7}, "SCR$"},
+		{[]byte{0xe8}, "{E8}"},
+
+		// numbers
+		{[]byte{0x80, 0x0b, 0x64, 0x00}, "GOTO100"},
+		{[]byte{'A', 0xc8, 0x11, 0xff, 0x00}, "A=&HFF"},
+		{[]byte{'A', 0xc8, 0x12, 0x39, 0x30}, "A=12345"},
+
+		// raw characters in strings, REM and DATA
+		{[]byte{0x8b, 0x22, 0x41, 0x8b, 0x22}, `PRINT"A` + CharToString(0x8b) + `"`},
+		{[]byte{0x95, ' ', 0x8b, ':', 0x80}, "REM " + CharToString(0x8b) + ":" + CharToString(0x80)},
+		{[]byte{0x91, 'A', 0x8b, ':', 0x8b}, "DATAA" + CharToString(0x8b) + ":PRINT"},
+
+		// EOL
+		{[]byte{0x8b, 0x00, 0x8b}, "PRINT"},
+	}
+	for _, tt := range tests {
+		got, err := Detokenize(tt.body)
+		if err != nil {
+			t.Errorf("% x: %v", tt.body, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("% x: got %q, want %q", tt.body, got, tt.want)
+		}
+	}
+
+	for _, body := range [][]byte{{0x0b}, {0x11, 0xff}, {0x12, 0x00}} {
+		if _, err := Detokenize(body); err == nil {
+			t.Errorf("% x: no error", body)
+		}
+	}
+}
+
+func TestParseProgram(t *testing.T) {
+	// 10 PRINT"A"
+	data := []byte{0x08, 0x0a, 0x00, 0x8b, 0x22, 0x41, 0x22, 0x00, 0x00}
+	lines, err := ParseProgram(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0].Number != 10 || string(lines[0].Body) != "\x8b\"A\"" {
+		t.Errorf("got %+v", lines)
+	}
+
+	for _, bad := range [][]byte{
+		{0x08, 0x0a, 0x00, 0x8b, 0x22, 0x41, 0x22, 0x00},       // no end mark
+		{0x08, 0x0a, 0x00, 0x8b, 0x22, 0x41, 0x22, 0x01, 0x00}, // no EOL
+		{0x03, 0x0a, 0x00, 0x00},                               // too short
+	} {
+		if _, err := ParseProgram(bad); err == nil {
+			t.Errorf("% x: no error", bad)
+		}
+	}
+}
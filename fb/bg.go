@@ -0,0 +1,144 @@
+package fb
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// BG GRAPHIC
+//
+// The data is the same layout as the name table of the PPU.
+//
+//	tiles:      32 x 30 bytes
+//	attributes:  8 x  8 bytes, 2 bits per 16x16 pixels
+//	  bit 1-0: top left
+//	  bit 3-2: top right
+//	  bit 5-4: bottom left
+//	  bit 7-6: bottom right
+const (
+	AttribBG = 0x03
+
+	BGWidth  = 32
+	BGHeight = 30
+	BGLen    = BGWidth*BGHeight + 64
+)
+
+// BG screen
+type BG struct {
+	Tiles    [BGHeight][BGWidth]byte
+	Palettes [BGHeight / 2][BGWidth / 2]byte // 0-3
+}
+
+// ParseBG parses the data of BG GRAPHIC.
+func ParseBG(data []byte) (*BG, error) {
+	if len(data) != BGLen {
+		return nil, fmt.Errorf("invalid length: %d", len(data))
+	}
+
+	bg := &BG{}
+	for y := 0; y < BGHeight; y++ {
+		copy(bg.Tiles[y][:], data[y*BGWidth:(y+1)*BGWidth])
+	}
+	attribs := data[BGWidth*BGHeight:]
+	for y := 0; y < BGHeight/2; y++ {
+		for x := 0; x < BGWidth/2; x++ {
+			a := attribs[(y/2)*8+x/2]
+			shift := ((y&1)*2 + (x & 1)) * 2
+			bg.Palettes[y][x] = (a >> shift) & 3
+		}
+	}
+	return bg, nil
+}
+
+// Bytes returns the data of BG GRAPHIC.
+func (bg *BG) Bytes() []byte {
+	data := make([]byte, BGLen)
+	for y := 0; y < BGHeight; y++ {
+		copy(data[y*BGWidth:(y+1)*BGWidth], bg.Tiles[y][:])
+	}
+	attribs := data[BGWidth*BGHeight:]
+	for y := 0; y < BGHeight/2; y++ {
+		for x := 0; x < BGWidth/2; x++ {
+			shift := ((y&1)*2 + (x & 1)) * 2
+			attribs[(y/2)*8+x/2] |= (bg.Palettes[y][x] & 3) << shift
+		}
+	}
+	return data
+}
+
+// String returns the tile map:
+//
+//	30 lines of 32 tiles in hex
+//	a blank line
+//	15 lines of 16 palettes (0-3)
+func (bg *BG) String() string {
+	var sb strings.Builder
+	for y := range bg.Tiles {
+		for x, t := range bg.Tiles[y] {
+			if x != 0 {
+				sb.WriteByte(' ')
+			}
+			fmt.Fprintf(&sb, "%02x", t)
+		}
+		sb.WriteByte('\n')
+	}
+	sb.WriteByte('\n')
+	for y := range bg.Palettes {
+		for _, p := range bg.Palettes[y] {
+			fmt.Fprintf(&sb, "%d", p)
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// ParseBGText parses the tile map written by BG.String.
+// Lines starting with '#' are ignored.
+func ParseBGText(r io.Reader) (*BG, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		lines = append(lines, l)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) != BGHeight+BGHeight/2 {
+		return nil, fmt.Errorf("invalid number of lines: %d", len(lines))
+	}
+
+	bg := &BG{}
+	for y, l := range lines[0:BGHeight] {
+		tiles := strings.Fields(l)
+		if len(tiles) != BGWidth {
+			return nil, fmt.Errorf("line %d: invalid number of tiles: %d", y, len(tiles))
+		}
+		for x, t := range tiles {
+			v, err := strconv.ParseUint(t, 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", y, err)
+			}
+			bg.Tiles[y][x] = byte(v)
+		}
+	}
+	for y, l := range lines[BGHeight:] {
+		if len(l) != BGWidth/2 {
+			return nil, fmt.Errorf("palette line %d: invalid length: %d", y, len(l))
+		}
+		for x, p := range []byte(l) {
+			if p < '0' || '3' < p {
+				return nil, errors.New("invalid palette")
+			}
+			bg.Palettes[y][x] = p - '0'
+		}
+	}
+	return bg, nil
+}
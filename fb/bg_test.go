@@ -0,0 +1,134 @@
+package fb
+
+import (
+	"bytes"
+	"image/color"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestBG(t *testing.T) {
+	data := make([]byte, BGLen)
+	rnd := rand.New(rand.NewSource(1))
+	rnd.Read(data)
+	// the bottom half of the last attributes is out of the screen: 30 rows
+	for i := BGLen - 8; i < BGLen; i++ {
+		data[i] &= 0x0f
+	}
+
+	bg, err := ParseBG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := bg.Bytes(); !bytes.Equal(got, data) {
+		t.Errorf("Bytes: got % x", got)
+	}
+
+	// tiles and attributes
+	data[1*BGWidth+2] = 0x41
+	data[BGWidth*BGHeight] = 0xe4 // from bit 1-0: 0, 1, 2, 3
+	data[BGWidth*BGHeight+8+1] = 0x1b
+	bg, err = ParseBG(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bg.Tiles[1][2] != 0x41 {
+		t.Errorf("tile: %02x", bg.Tiles[1][2])
+	}
+	for _, tt := range []struct{ x, y, p int }{
+		{0, 0, 0}, {1, 0, 1}, {0, 1, 2}, {1, 1, 3}, // top left, top right, bottom left, bottom right
+		{2, 2, 3}, {3, 2, 2}, {2, 3, 1}, {3, 3, 0},
+	} {
+		if got := bg.Palettes[tt.y][tt.x]; int(got) != tt.p {
+			t.Errorf("palette %d,%d: got %d, want %d", tt.x, tt.y, got, tt.p)
+		}
+	}
+
+	// text
+	bg2, err := ParseBGText(strings.NewReader("# comment\n" + bg.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *bg2 != *bg {
+		t.Errorf("text: got\n%s", bg2)
+	}
+
+	if _, err := ParseBG(data[1:]); err == nil {
+		t.Errorf("length: no error")
+	}
+}
+
+func TestBGImage(t *testing.T) {
+	// the first tiles of the placeholder: box of color 1, 2, 3 and 0
+	bg := &BG{}
+	for y := range bg.Tiles {
+		for x := range bg.Tiles[y] {
+			bg.Tiles[y][x] = byte(0x21 + (x+y)%4)
+		}
+	}
+	for y := range bg.Palettes {
+		for x := range bg.Palettes[y] {
+			bg.Palettes[y][x] = byte(x*3+y) % 4
+		}
+	}
+	chr := PlaceholderCHR()
+	img := bg.Image(chr, &DefaultPalettes)
+	if img.Bounds().Dx() != 256 || img.Bounds().Dy() != 240 {
+		t.Fatalf("size: %v", img.Bounds())
+	}
+	if got := img.RGBAAt(0, 0); got != nesColors[DefaultPalettes[0][3]] {
+		t.Errorf("border: %v", got)
+	}
+
+	got, mismatches, err := BGFromImage(img, chr, &DefaultPalettes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches != 0 {
+		t.Errorf("mismatches: %d", mismatches)
+	}
+	if *got != *bg {
+		t.Errorf("got\n%s", got)
+	}
+
+	// no tiles in a blank CHR
+	_, mismatches, err = BGFromImage(img, make(CHR, chrLen), &DefaultPalettes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mismatches != BGWidth*BGHeight {
+		t.Errorf("blank CHR: mismatches %d", mismatches)
+	}
+
+	if _, _, err := BGFromImage(img.SubImage(img.Rect.Inset(1)), chr, &DefaultPalettes); err == nil {
+		t.Errorf("size: no error")
+	}
+}
+
+func TestNearest(t *testing.T) {
+	tests := []struct {
+		c    color.RGBA
+		want byte
+	}{
+		{color.RGBA{0x00, 0x00, 0x00, 0xff}, 0},
+		{color.RGBA{0xf0, 0xf0, 0xf0, 0xff}, 1}, // 0x30
+		{color.RGBA{0xb0, 0x10, 0x10, 0xff}, 2}, // 0x16
+		{color.RGBA{0xff, 0xb0, 0x00, 0xff}, 3}, // 0x27
+	}
+	for _, tt := range tests {
+		if got, _ := nearest(tt.c, DefaultPalettes[0]); got != tt.want {
+			t.Errorf("%v: got %d, want %d", tt.c, got, tt.want)
+		}
+	}
+
+	p, err := ParsePalettes("0f301627,0f2a1a0a,0f211201,0f281707")
+	if err != nil || *p != DefaultPalettes {
+		t.Errorf("ParsePalettes: %v, %v", p, err)
+	}
+	for _, s := range []string{"0f301627", "0f301627,0f2a1a0a,0f211201,0f2817", "0f301627,0f2a1a0a,0f211201,0f281740"} {
+		if _, err := ParsePalettes(s); err == nil {
+			t.Errorf("%q: no error", s)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package fb
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+// NES colors
+var nesColors = [64]color.RGBA{
+	{0x7c, 0x7c, 0x7c, 0xff}, {0x00, 0x00, 0xfc, 0xff}, {0x00, 0x00, 0xbc, 0xff}, {0x44, 0x28, 0xbc, 0xff},
+	{0x94, 0x00, 0x84, 0xff}, {0xa8, 0x00, 0x20, 0xff}, {0xa8, 0x10, 0x00, 0xff}, {0x88, 0x14, 0x00, 0xff},
+	{0x50, 0x30, 0x00, 0xff}, {0x00, 0x78, 0x00, 0xff}, {0x00, 0x68, 0x00, 0xff}, {0x00, 0x58, 0x00, 0xff},
+	{0x00, 0x40, 0x58, 0xff}, {0x00, 0x00, 0x00, 0xff}, {0x00, 0x00, 0x00, 0xff}, {0x00, 0x00, 0x00, 0xff},
+	{0xbc, 0xbc, 0xbc, 0xff}, {0x00, 0x78, 0xf8, 0xff}, {0x00, 0x58, 0xf8, 0xff}, {0x68, 0x44, 0xfc, 0xff},
+	{0xd8, 0x00, 0xcc, 0xff}, {0xe4, 0x00, 0x58, 0xff}, {0xf8, 0x38, 0x00, 0xff}, {0xe4, 0x5c, 0x10, 0xff},
+	{0xac, 0x7c, 0x00, 0xff}, {0x00, 0xb8, 0x00, 0xff}, {0x00, 0xa8, 0x00, 0xff}, {0x00, 0xa8, 0x44, 0xff},
+	{0x00, 0x88, 0x88, 0xff}, {0x00, 0x00, 0x00, 0xff}, {0x00, 0x00, 0x00, 0xff}, {0x00, 0x00, 0x00, 0xff},
+	{0xf8, 0xf8, 0xf8, 0xff}, {0x3c, 0xbc, 0xfc, 0xff}, {0x68, 0x88, 0xfc, 0xff}, {0x98, 0x78, 0xf8, 0xff},
+	{0xf8, 0x78, 0xf8, 0xff}, {0xf8, 0x58, 0x98, 0xff}, {0xf8, 0x78, 0x58, 0xff}, {0xfc, 0xa0, 0x44, 0xff},
+	{0xf8, 0xb8, 0x00, 0xff}, {0xb8, 0xf8, 0x18, 0xff}, {0x58, 0xd8, 0x54, 0xff}, {0x58, 0xf8, 0x98, 0xff},
+	{0x00, 0xe8, 0xd8, 0xff}, {0x78, 0x78, 0x78, 0xff}, {0x00, 0x00, 0x00, 0xff}, {0x00, 0x00, 0x00, 0xff},
+	{0xfc, 0xfc, 0xfc, 0xff}, {0xa4, 0xe4, 0xfc, 0xff}, {0xb8, 0xb8, 0xf8, 0xff}, {0xd8, 0xb8, 0xf8, 0xff},
+	{0xf8, 0xb8, 0xf8, 0xff}, {0xf8, 0xa4, 0xc0, 0xff}, {0xf0, 0xd0, 0xb0, 0xff}, {0xfc, 0xe0, 0xa8, 0xff},
+	{0xf8, 0xd8, 0x78, 0xff}, {0xd8, 0xf8, 0x78, 0xff}, {0xb8, 0xf8, 0xb8, 0xff}, {0xb8, 0xf8, 0xd8, 0xff},
+	{0x00, 0xfc, 0xfc, 0xff}, {0xf8, 0xd8, 0xf8, 0xff}, {0x00, 0x00, 0x00, 0xff}, {0x00, 0x00, 0x00, 0xff},
+}
+
+// Palettes of BG: 4 palettes x 4 NES colors
+type Palettes [4][4]byte
+
+// DefaultPalettes is the BG palettes after power on (PALET B).
+var DefaultPalettes = Palettes{
+	{0x0f, 0x30, 0x16, 0x27},
+	{0x0f, 0x2a, 0x1a, 0x0a},
+	{0x0f, 0x21, 0x12, 0x01},
+	{0x0f, 0x28, 0x17, 0x07},
+}
+
+// ParsePalettes parses "0f301627,0f2a1a0a,0f211201,0f281707".
+func ParsePalettes(s string) (*Palettes, error) {
+	pals := strings.Split(s, ",")
+	if len(pals) != 4 {
+		return nil, errors.New("need 4 palettes")
+	}
+
+	var p Palettes
+	for i, pal := range pals {
+		if len(pal) != 8 {
+			return nil, fmt.Errorf("palette %d: need 4 colors", i)
+		}
+		for j := 0; j < 4; j++ {
+			c, err := strconv.ParseUint(pal[j*2:j*2+2], 16, 8)
+			if err != nil {
+				return nil, err
+			}
+			if c >= uint64(len(nesColors)) {
+				return nil, fmt.Errorf("palette %d: invalid color: %02x", i, c)
+			}
+			p[i][j] = byte(c)
+		}
+	}
+	return &p, nil
+}
+
+// CHR is the pattern table of BG characters: 256 tiles x 16 bytes
+type CHR []byte
+
+const chrLen = 256 * 16
+
+// ParseCHR parses a 4KB pattern table.
+// For an 8KB CHR, the first half is used.
+func ParseCHR(data []byte) (CHR, error) {
+	if len(data) != chrLen && len(data) != chrLen*2 {
+		return nil, fmt.Errorf("invalid CHR length: %d", len(data))
+	}
+	return CHR(data[0:chrLen]), nil
+}
+
+// PlaceholderCHR is used when the real character set is not available.
+// Each tile is a box filled with the color of its lowest 2 bits, space is blank.
+func PlaceholderCHR() CHR {
+	chr := make(CHR, chrLen)
+	for t := 0; t < 256; t++ {
+		if t == 0x00 || t == 0x20 {
+			continue
+		}
+		fill := byte(t & 3)
+		for y := 0; y < 8; y++ {
+			var p0, p1 byte
+			for x := 0; x < 8; x++ {
+				c := fill
+				if x == 0 || y == 0 || x == 7 || y == 7 {
+					c = 3
+				}
+				p0 |= (c & 1) << (7 - x)
+				p1 |= (c >> 1) << (7 - x)
+			}
+			chr[t*16+y] = p0
+			chr[t*16+8+y] = p1
+		}
+	}
+	return chr
+}
+
+// pixel returns the color number (0-3) of a tile.
+func (chr CHR) pixel(tile byte, x, y int) byte {
+	p0 := chr[int(tile)*16+y]
+	p1 := chr[int(tile)*16+8+y]
+	return ((p0 >> (7 - x)) & 1) | ((p1>>(7-x))&1)<<1
+}
+
+// Image renders the BG screen: 256x240 pixels
+func (bg *BG) Image(chr CHR, pal *Palettes) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, BGWidth*8, BGHeight*8))
+	for ty := 0; ty < BGHeight; ty++ {
+		for tx := 0; tx < BGWidth; tx++ {
+			p := bg.Palettes[ty/2][tx/2]
+			for y := 0; y < 8; y++ {
+				for x := 0; x < 8; x++ {
+					c := chr.pixel(bg.Tiles[ty][tx], x, y)
+					img.SetRGBA(tx*8+x, ty*8+y, nesColors[pal[p][c]])
+				}
+			}
+		}
+	}
+	return img
+}
+
+func colorDistance(c color.Color, n byte) int {
+	r, g, b, _ := c.RGBA()
+	dr := int(r>>8) - int(nesColors[n].R)
+	dg := int(g>>8) - int(nesColors[n].G)
+	db := int(b>>8) - int(nesColors[n].B)
+	return dr*dr + dg*dg + db*db
+}
+
+// nearest returns the color number (0-3) and its distance in the palette.
+func nearest(c color.Color, pal [4]byte) (byte, int) {
+	num := byte(0)
+	dist := colorDistance(c, pal[0])
+	for i := 1; i < 4; i++ {
+		d := colorDistance(c, pal[i])
+		if d < dist {
+			num = byte(i)
+			dist = d
+		}
+	}
+	return num, dist
+}
+
+// BGFromImage converts a 256x240 image to the BG screen.
+// It returns the number of tiles not found in the CHR, those are replaced with the nearest tiles.
+func BGFromImage(img image.Image, chr CHR, pal *Palettes) (*BG, int, error) {
+	r := img.Bounds()
+	if r.Dx() != BGWidth*8 || r.Dy() != BGHeight*8 {
+		return nil, 0, fmt.Errorf("invalid image size: %dx%d", r.Dx(), r.Dy())
+	}
+
+	bg := &BG{}
+	mismatches := 0
+	for py := 0; py < BGHeight/2; py++ {
+		for px := 0; px < BGWidth/2; px++ {
+			// palette: minimum distance in 16x16 pixels
+			best := -1
+			for p := range pal {
+				dist := 0
+				for y := 0; y < 16; y++ {
+					for x := 0; x < 16; x++ {
+						_, d := nearest(img.At(r.Min.X+px*16+x, r.Min.Y+py*16+y), pal[p])
+						dist += d
+					}
+				}
+				if best < 0 || dist < best {
+					best = dist
+					bg.Palettes[py][px] = byte(p)
+				}
+			}
+
+			// tiles
+			for ty := py * 2; ty < py*2+2; ty++ {
+				for tx := px * 2; tx < px*2+2; tx++ {
+					var pattern [8][8]byte
+					for y := 0; y < 8; y++ {
+						for x := 0; x < 8; x++ {
+							pattern[y][x], _ = nearest(img.At(r.Min.X+tx*8+x, r.Min.Y+ty*8+y), pal[bg.Palettes[py][px]])
+						}
+					}
+					tile, diff := chr.find(&pattern)
+					if diff != 0 {
+						mismatches++
+					}
+					bg.Tiles[ty][tx] = tile
+				}
+			}
+		}
+	}
+	return bg, mismatches, nil
+}
+
+// find returns the tile most similar to the pattern and the number of different pixels.
+// Space is preferred for blank tiles.
+func (chr CHR) find(pattern *[8][8]byte) (byte, int) {
+	best := byte(0)
+	bestDiff := -1
+	for i := 0; i < 256; i++ {
+		tile := byte(i + 0x20) // from space
+		diff := 0
+		for y := 0; y < 8; y++ {
+			for x := 0; x < 8; x++ {
+				if chr.pixel(tile, x, y) != pattern[y][x] {
+					diff++
+				}
+			}
+		}
+		if bestDiff < 0 || diff < bestDiff {
+			best = tile
+			bestDiff = diff
+			if diff == 0 {
+				break
+			}
+		}
+	}
+	return best, bestDiff
+}
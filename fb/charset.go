@@ -0,0 +1,95 @@
+package fb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// graphic characters: 0x60 - 0x7F
+var graphics60 = [0x20]rune{
+	'♠', '♥', '♦', '♣', '●', '○', '◆', '◇', '■', '□', '▲', '△', '▼', '▽', '★', '☆',
+	'─', '│', '┼', '┴', '┬', '┤', '├', '┌', '┐', '└', '┘', '╱', '╲', '╳', '←', '→',
+}
+
+// graphic characters and the wide space: 0x80 - 0xA0
+var graphics80 = [0x21]rune{
+	'▁', '▂', '▃', '▄', '▅', '▆', '▇', '█', '▏', '▎', '▍', '▌', '▋', '▊', '▉', '▀',
+	'▐', '▔', '▕', '◢', '◣', '◤', '◥', '◼', '◻', '╭', '╮', '╰', '╯', '↑', '↓', 'π',
+	'　',
+}
+
+// graphic characters: 0xE0 - 0xFF
+var graphicsE0 = [0x20]rune{
+	'円', '年', '月', '日', '時', '分', '秒', '百', '千', '万', '大', '中', '小', '上', '下', '左',
+	'右', '田', '人', '子', '女', '王', '生', '金', '土', '木', '水', '火', '天', '地', '×', '÷',
+}
+
+// CharToString converts a character code of FB to a unicode string.
+// Unknown codes are escaped as "{XX}".
+func CharToString(c byte) string {
+	switch {
+	case c == 0x5c:
+		return "¥"
+	case 0x20 <= c && c < 0x60:
+		return string(rune(c))
+	case 0x60 <= c && c < 0x80:
+		return string(graphics60[c-0x60])
+	case 0x80 <= c && c <= 0xa0:
+		return string(graphics80[c-0x80])
+	case 0xa1 <= c && c < 0xe0:
+		// katakana: JIS X 0201
+		return string(rune(0xff61 + int(c) - 0xa1))
+	case 0xe0 <= c:
+		return string(graphicsE0[c-0xe0])
+	}
+	return fmt.Sprintf("{%02X}", c)
+}
+
+// CharsToString converts character codes of FB to a unicode string.
+func CharsToString(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		sb.WriteString(CharToString(c))
+	}
+	return sb.String()
+}
+
+// StringToChars converts a unicode string to character codes of FB.
+// It's the reverse of CharToString.
+func StringToChars(s string) ([]byte, error) {
+	ret := make([]byte, 0, len(s))
+	for len(s) > 0 {
+		if s[0] == '{' && len(s) >= 4 && s[3] == '}' {
+			c, err := strconv.ParseUint(s[1:3], 16, 8)
+			if err == nil {
+				ret = append(ret, byte(c))
+				s = s[4:]
+				continue
+			}
+		}
+
+		r, size := utf8.DecodeRuneInString(s)
+		c, ok := charCodes[r]
+		if !ok {
+			return nil, fmt.Errorf("unknown character: %q", r)
+		}
+		ret = append(ret, c)
+		s = s[size:]
+	}
+	return ret, nil
+}
+
+var charCodes = func() map[rune]byte {
+	m := make(map[rune]byte)
+	for c := 0x20; c < 0x100; c++ {
+		s := CharToString(byte(c))
+		if !strings.HasPrefix(s, "{") {
+			m[[]rune(s)[0]] = byte(c)
+		}
+	}
+	// aliases
+	m['\\'] = 0x5c
+	return m
+}()
@@ -0,0 +1,60 @@
+package fb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCharToString(t *testing.T) {
+	tests := []struct {
+		c    byte
+		want string
+	}{
+		{0x0a, "{0A}"},
+		{0x20, " "},
+		{0x41, "A"},
+		{0x5c, "¥"},
+		{0x60, "♠"},
+		{0x7f, "→"},
+		{0x80, "▁"},
+		{0x9f, "π"},
+		{0xa0, "　"},
+		{0xa1, "｡"},
+		{0xb1, "ｱ"},
+		{0xdf, "ﾟ"},
+		{0xe0, "円"},
+		{0xff, "÷"},
+	}
+	for _, tt := range tests {
+		if got := CharToString(tt.c); got != tt.want {
+			t.Errorf("%02x: got %q, want %q", tt.c, got, tt.want)
+		}
+	}
+}
+
+func TestStringToChars(t *testing.T) {
+	for c := 0; c < 0x100; c++ {
+		s := CharToString(byte(c))
+		got, err := StringToChars(s)
+		if err != nil {
+			t.Errorf("%02x: %q: %v", c, s, err)
+			continue
+		}
+		if !bytes.Equal(got, []byte{byte(c)}) {
+			t.Errorf("%02x: %q: got % x", c, s, got)
+		}
+	}
+
+	// aliases and names
+	got, err := StringToChars(`\ｱｲ`)
+	if err != nil || !bytes.Equal(got, []byte{0x5c, 0xb1, 0xb2}) {
+		t.Errorf("aliases: got % x, %v", got, err)
+	}
+	if s := CharsToString([]byte{0xb1, 0xb2, 0x60, 'A'}); s != "ｱｲ♠A" {
+		t.Errorf("name: %q", s)
+	}
+
+	if _, err := StringToChars("あ"); err == nil {
+		t.Errorf("hiragana: no error")
+	}
+}
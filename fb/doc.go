@@ -0,0 +1,2 @@
+// Family BASIC
+package fb
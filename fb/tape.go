@@ -0,0 +1,183 @@
+package fb
+
+import (
+	"errors"
+	"math/bits"
+	"path/filepath"
+	"strings"
+)
+
+// attributes of the info block
+const (
+	AttribBASIC = 0x02
+)
+
+// tape format
+//
+//	leader: zeros
+//	info block:
+//	  mark:  40 ones, 40 zeros
+//	  start: 1
+//	  info:  128 bytes
+//	  sum:   2 bytes
+//	  end:   1
+//	leader: zeros
+//	data block:
+//	  mark:  20 ones, 20 zeros
+//	  start: 1
+//	  data:  dataLen bytes
+//	  sum:   2 bytes
+//	  end:   1
+//
+// byte: start bit(1) + 8 bits from MSB
+const (
+	InfoLeaderZeros = 20000 // about 10 sec
+	DataLeaderZeros = 10000 // about 5 sec
+
+	InfoLen = 128
+	NameLen = 16
+)
+
+// Info block
+type Info struct {
+	Attrib   byte
+	Name     string
+	Reserved byte
+	DataLen  uint16
+	LoadAddr uint16
+	CallAddr uint16
+}
+
+// TapeName returns the name on tape of a file path: "01_NAME.bin" (extracted by FB2bin) -> "NAME".
+func TapeName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if len(name) > 3 && '0' <= name[0] && name[0] <= '9' && '0' <= name[1] && name[1] <= '9' && name[2] == '_' {
+		name = name[3:]
+	}
+	name = strings.ToUpper(name)
+	if len(name) > NameLen {
+		name = name[0:NameLen]
+	}
+	return name
+}
+
+// FileName returns a safe name for the file system.
+// The character codes other than ASCII are replaced with '_'.
+func FileName(name []byte) string {
+	ret := append([]byte(nil), name...)
+	for i, c := range ret {
+		if c < 0x20 || c >= 0x7f || strings.IndexByte(`/\:*?"<>|`, c) >= 0 {
+			ret[i] = '_'
+		}
+	}
+	if len(ret) == 0 {
+		return "noname"
+	}
+	return string(ret)
+}
+
+// ParseInfo parses the 128 bytes of an info block.
+func ParseInfo(b []byte) (Info, error) {
+	if len(b) != InfoLen {
+		return Info{}, errors.New("invalid length")
+	}
+
+	name := b[1 : 1+NameLen]
+	for i, c := range name {
+		if c == 0x00 {
+			// null-terminated
+			name = name[0:i]
+			break
+		}
+	}
+	return Info{
+		Attrib:   b[0],
+		Name:     string(name),
+		Reserved: b[17],
+		DataLen:  uint16(b[18]) | uint16(b[19])<<8,
+		LoadAddr: uint16(b[20]) | uint16(b[21])<<8,
+		CallAddr: uint16(b[22]) | uint16(b[23])<<8,
+	}, nil
+}
+
+// Bytes returns the 128 bytes of the info block.
+func (info *Info) Bytes() []byte {
+	b := make([]byte, InfoLen)
+	b[0] = info.Attrib
+	copy(b[1:1+NameLen], info.Name)
+	b[17] = info.Reserved
+	b[18], b[19] = byte(info.DataLen), byte(info.DataLen>>8)
+	b[20], b[21] = byte(info.LoadAddr), byte(info.LoadAddr>>8)
+	b[22], b[23] = byte(info.CallAddr), byte(info.CallAddr>>8)
+	// emp: 104 bytes
+	return b
+}
+
+// Checksum of a block (info or data).
+// FB counts the number of 1 bits in the payload bytes, start bits are not included.
+//
+//	info block: 128 bytes (attrib, name, reserved, dataLen, loadAddr, callAddr, emp)
+//	data block: dataLen bytes
+func Checksum(data []byte) uint16 {
+	var sum uint16
+	for _, b := range data {
+		sum += uint16(bits.OnesCount8(b))
+	}
+	return sum
+}
+
+// AppendByte appends the bits of a byte: start bit(1) + 8 bits from MSB.
+func AppendByte(dst []byte, b byte) []byte {
+	dst = append(dst, 1)
+	for i := 7; i >= 0; i-- {
+		dst = append(dst, (b>>i)&1)
+	}
+	return dst
+}
+
+func appendRepeat(dst []byte, b byte, n int) []byte {
+	for i := 0; i < n; i++ {
+		dst = append(dst, b)
+	}
+	return dst
+}
+
+func appendBlock(dst []byte, payload []byte) []byte {
+	dst = append(dst, 1) // start
+	for _, b := range payload {
+		dst = AppendByte(dst, b)
+	}
+	sum := Checksum(payload)
+	dst = AppendByte(dst, byte(sum))
+	dst = AppendByte(dst, byte(sum>>8))
+	return append(dst, 1) // end
+}
+
+// InfoBlockBits returns the bits of an info block with its leader.
+func InfoBlockBits(info *Info) []byte {
+	bits := make([]byte, 0, InfoLeaderZeros+80+1+(InfoLen+2)*9+1)
+	bits = appendRepeat(bits, 0, InfoLeaderZeros)
+	bits = appendRepeat(bits, 1, 40)
+	bits = appendRepeat(bits, 0, 40)
+	return appendBlock(bits, info.Bytes())
+}
+
+// DataBlockBits returns the bits of a data block with its leader.
+func DataBlockBits(data []byte) []byte {
+	bits := make([]byte, 0, DataLeaderZeros+40+1+(len(data)+2)*9+1)
+	bits = appendRepeat(bits, 0, DataLeaderZeros)
+	bits = appendRepeat(bits, 1, 20)
+	bits = appendRepeat(bits, 0, 20)
+	return appendBlock(bits, data)
+}
+
+// TapeBits returns the bits of a file: the info block and the data block.
+func TapeBits(info *Info, data []byte) ([]byte, error) {
+	if len(data) != int(info.DataLen) {
+		return nil, errors.New("invalid data length")
+	}
+	if len(info.Name) > NameLen {
+		return nil, errors.New("too long name")
+	}
+	return append(InfoBlockBits(info), DataBlockBits(data)...), nil
+}
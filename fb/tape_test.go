@@ -0,0 +1,32 @@
+package fb
+
+import "testing"
+
+func TestTapeName(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"hello.bas", "HELLO"},
+		{"dir/03_excite1.bin", "EXCITE1"},
+		{"a_very_long_file_name.bin", "A_VERY_LONG_FILE"},
+	}
+	for _, tt := range tests {
+		if got := TapeName(tt.path); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := []struct {
+		name []byte
+		want string
+	}{
+		{[]byte("ONE"), "ONE"},
+		{[]byte{0xb1, 'A', '?', '*'}, "_A__"},
+		{nil, "noname"},
+	}
+	for _, tt := range tests {
+		if got := FileName(tt.name); got != tt.want {
+			t.Errorf("% x: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
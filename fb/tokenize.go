@@ -0,0 +1,203 @@
+package fb
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keywords which take line numbers
+var lineNumTokens = map[byte]bool{
+	0x80: true, // GOTO
+	0x81: true, // GOSUB
+	0x82: true, // RUN
+	0x84: true, // RESTORE
+	0x85: true, // THEN
+	0x86: true, // LIST
+}
+
+// token codes sorted by length (longest match first)
+var tokenCodes = func() []byte {
+	codes := make([]byte, len(tokens))
+	for i := range tokens {
+		codes[i] = byte(tokenFirst + i)
+	}
+	sort.SliceStable(codes, func(i, j int) bool {
+		return len(tokens[codes[i]-tokenFirst]) > len(tokens[codes[j]-tokenFirst])
+	})
+	return codes
+}()
+
+// TokenizeLine converts a text line "10 PRINT ..." to a Line.
+func TokenizeLine(text string) (Line, error) {
+	text = strings.TrimLeft(text, " ")
+	i := 0
+	for i < len(text) && '0' <= text[i] && text[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return Line{}, fmt.Errorf("no line number: %q", text)
+	}
+	num, err := strconv.ParseUint(text[0:i], 10, 16)
+	if err != nil {
+		return Line{}, err
+	}
+	// a space after the line number is just a separator
+	text = strings.TrimPrefix(text[i:], " ")
+
+	body, err := Tokenize(text)
+	if err != nil {
+		return Line{}, fmt.Errorf("line %d: %w", num, err)
+	}
+	return Line{Number: uint16(num), Body: body}, nil
+}
+
+// Tokenize converts the body of a line to intermediate codes.
+// It's the reverse of Detokenize.
+func Tokenize(text string) ([]byte, error) {
+	ret := make([]byte, 0, len(text))
+
+	lineNum := false
+	for len(text) > 0 {
+		c := text[0]
+
+		// string
+		if c == '"' {
+			end := strings.IndexByte(text[1:], '"')
+			if end < 0 {
+				end = len(text)
+			} else {
+				end += 2
+			}
+			chars, err := StringToChars(text[:end])
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, chars...)
+			text = text[end:]
+			lineNum = false
+			continue
+		}
+
+		// hex
+		if len(text) >= 2 && strings.EqualFold(text[0:2], "&H") {
+			i := 2
+			for i < len(text) && strings.IndexByte("0123456789ABCDEFabcdef", text[i]) >= 0 {
+				i++
+			}
+			v, err := strconv.ParseUint(text[2:i], 16, 16)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, codeHex, byte(v), byte(v>>8))
+			text = text[i:]
+			lineNum = false
+			continue
+		}
+
+		// decimal or line number
+		if '0' <= c && c <= '9' {
+			i := 0
+			for i < len(text) && '0' <= text[i] && text[i] <= '9' {
+				i++
+			}
+			v, err := strconv.ParseUint(text[0:i], 10, 16)
+			if err != nil {
+				return nil, err
+			}
+			if lineNum {
+				ret = append(ret, codeLineNum, byte(v), byte(v>>8))
+			} else {
+				ret = append(ret, codeDec, byte(v), byte(v>>8))
+			}
+			text = text[i:]
+			continue
+		}
+
+		// keywords
+		if code, ok := matchToken(text); ok {
+			ret = append(ret, code)
+			text = text[len(tokens[code-tokenFirst]):]
+			lineNum = lineNumTokens[code]
+
+			switch code {
+			case tokenREM:
+				// comment
+				chars, err := StringToChars(text)
+				if err != nil {
+					return nil, err
+				}
+				return append(ret, chars...), nil
+			case tokenDATA:
+				// raw characters until ':'
+				end := dataEnd(text)
+				chars, err := StringToChars(text[:end])
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, chars...)
+				text = text[end:]
+			}
+			continue
+		}
+
+		// others
+		if c >= 0x80 {
+			return nil, errors.New("non-ASCII character outside of string")
+		}
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		ret = append(ret, c)
+		text = text[1:]
+		if c != ' ' && c != ',' {
+			lineNum = false
+		}
+	}
+
+	return ret, nil
+}
+
+func matchToken(text string) (byte, bool) {
+	for _, code := range tokenCodes {
+		t := tokens[code-tokenFirst]
+		if len(text) >= len(t) && strings.EqualFold(text[:len(t)], t) {
+			return code, true
+		}
+	}
+	return 0, false
+}
+
+func dataEnd(text string) int {
+	inString := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"':
+			inString = !inString
+		case ':':
+			if !inString {
+				return i
+			}
+		}
+	}
+	return len(text)
+}
+
+// Program encodes lines to BASIC code (attrib 0x02).
+func Program(lines []Line) ([]byte, error) {
+	ret := make([]byte, 0, 4096)
+	for _, l := range lines {
+		length := 1 + 2 + len(l.Body) + 1
+		if length > 0xff {
+			return nil, fmt.Errorf("line %d: too long: %d", l.Number, length)
+		}
+		ret = append(ret, byte(length), byte(l.Number), byte(l.Number>>8))
+		ret = append(ret, l.Body...)
+		ret = append(ret, codeEOL)
+	}
+	// end mark
+	ret = append(ret, 0x00)
+	return ret, nil
+}
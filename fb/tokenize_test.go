@@ -0,0 +1,137 @@
+package fb
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []byte
+		list string // Detokenize, "" for text
+	}{
+		{`PRINT"A"`, []byte{0x8b, '"', 'A', '"'}, ""},
+		{`PRINT "ｱ♠"`, []byte{0x8b, ' ', '"', 0xb1, 0x60, '"'}, ""},
+		{`GOTO 100`, []byte{0x80, ' ', 0x0b, 100, 0}, ""},
+		{`ON X GOTO 10,20`, []byte{0x9a, ' ', 'X', ' ', 0x80, ' ', 0x0b, 10, 0, ',', 0x0b, 20, 0}, ""},
+		{`IF A=1 THEN 20`, []byte{0x92, ' ', 'A', 0xc8, 0x12, 1, 0, ' ', 0x85, ' ', 0x0b, 20, 0}, ""},
+		{`A=12345`, []byte{'A', 0xc8, 0x12, 0x39, 0x30}, ""},
+		{`A=&HFF`, []byte{'A', 0xc8, 0x11, 0xff, 0x00}, ""},
+		{`REM HI:PRINT`, []byte{0x95, ' ', 'H', 'I', ':', 'P', 'R', 'I', 'N', 'T'}, ""},
+		{`DATA 1,A:END`, []byte{0x91, ' ', '1', ',', 'A', ':', 0xa2}, ""},
+		{`a$=left$(b$,1)`, []byte{'A', '$', 0xc8, 0xe6, '(', 'B', '$', ',', 0x12, 1, 0, ')'}, "A$=LEFT$(B$,1)"},
+	}
+	for _, tt := range tests {
+		got, err := Tokenize(tt.text)
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%q: got % x, want % x", tt.text, got, tt.want)
+			continue
+		}
+
+		list, err := Detokenize(got)
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		want := tt.list
+		if want == "" {
+			want = tt.text
+		}
+		if list != want {
+			t.Errorf("%q: list %q, want %q", tt.text, list, want)
+		}
+	}
+}
+
+func TestTokenizeError(t *testing.T) {
+	for _, text := range []string{`A=70000`, `A=&H10000`, `PRINT"あ"`, `Aあ`} {
+		if _, err := Tokenize(text); err == nil {
+			t.Errorf("%q: no error", text)
+		}
+	}
+	if _, err := TokenizeLine(`PRINT"A"`); err == nil {
+		t.Errorf("no line number: no error")
+	}
+}
+
+// readBlock reads a block after the leader: mark, start bit, bytes, checksum and end bit.
+func readBlock(t *testing.T, bits []byte, leader, mark, n int) ([]byte, uint16, []byte) {
+	t.Helper()
+	want := append(bytes.Repeat([]byte{0}, leader), bytes.Repeat([]byte{1}, mark)...)
+	want = append(want, bytes.Repeat([]byte{0}, mark)...)
+	want = append(want, 1)
+	if len(bits) < len(want)+(n+2)*9+1 || !bytes.Equal(bits[0:len(want)], want) {
+		t.Fatalf("invalid leader or mark")
+	}
+	bits = bits[len(want):]
+
+	payload := make([]byte, n+2)
+	for i := range payload {
+		if bits[0] != 1 {
+			t.Fatalf("byte %d: invalid start bit", i)
+		}
+		for _, b := range bits[1:9] {
+			payload[i] = payload[i]<<1 | b
+		}
+		bits = bits[9:]
+	}
+	if bits[0] != 1 {
+		t.Fatalf("invalid end bit")
+	}
+	return payload[0:n], uint16(payload[n]) | uint16(payload[n+1])<<8, bits[1:]
+}
+
+func TestTapeBits(t *testing.T) {
+	line, err := TokenizeLine(`10 PRINT"A"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Program([]Line{line})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// length, number, body, EOL, end mark
+	want := []byte{0x08, 0x0a, 0x00, 0x8b, '"', 'A', '"', 0x00, 0x00}
+	if !bytes.Equal(data, want) {
+		t.Fatalf("program: got % x, want % x", data, want)
+	}
+
+	info := &Info{Attrib: AttribBASIC, Name: "ONE", DataLen: uint16(len(data)), LoadAddr: 0x6006}
+	bits, err := TapeBits(info, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, sum, bits := readBlock(t, bits, InfoLeaderZeros, 40, InfoLen)
+	wantInfo := []byte{0x02, 'O', 'N', 'E', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x00, 0x09, 0x00, 0x06, 0x60, 0x00, 0x00}
+	if !bytes.Equal(payload[0:len(wantInfo)], wantInfo) || len(bytes.Trim(payload[len(wantInfo):], "\x00")) != 0 {
+		t.Errorf("info: got % x", payload)
+	}
+	// 1 bits: attrib 1, name 5+4+3, dataLen 2, loadAddr 2+2
+	if sum != 0x13 {
+		t.Errorf("info checksum: %04x", sum)
+	}
+	if parsed, err := ParseInfo(payload); err != nil || parsed != *info {
+		t.Errorf("info: %+v, %v", parsed, err)
+	}
+
+	payload, sum, bits = readBlock(t, bits, DataLeaderZeros, 20, len(data))
+	if !bytes.Equal(payload, data) {
+		t.Errorf("data: got % x", payload)
+	}
+	if sum != 0x0d {
+		t.Errorf("data checksum: %04x", sum)
+	}
+	if len(bits) != 0 {
+		t.Errorf("%d bits after the data block", len(bits))
+	}
+
+	if _, err := TapeBits(info, data[1:]); err == nil {
+		t.Errorf("data length: no error")
+	}
+}
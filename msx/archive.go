@@ -0,0 +1,147 @@
+package msx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// CAS is the files in a .CAS file.
+type CAS struct {
+	Files []*File
+}
+
+// ReadCAS reads the files in a .CAS file.
+func ReadCAS(data []byte) (*CAS, error) {
+	blocks := SplitCAS(data)
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no CAS header")
+	}
+	files := Files(blocks)
+	for _, f := range files {
+		if f.Header == nil || f.Type != TypeBinary {
+			continue
+		}
+		// the padding after the code
+		// BASIC can't be trimmed: the program is followed by 0x00s on tape.
+		_, code, err := ParseBinary(f.Data)
+		if err != nil {
+			continue
+		}
+		n := BinHeaderLen + len(code)
+		if len(f.Data) > n && len(bytes.Trim(f.Data[n:], "\x00")) == 0 {
+			f.Data = f.Data[0:n]
+		}
+	}
+	return &CAS{Files: files}, nil
+}
+
+// Bytes returns the .CAS file.
+func (c *CAS) Bytes() []byte {
+	var b bytes.Buffer
+	cw := NewCASWriter(&b)
+	for _, f := range c.Files {
+		for _, block := range f.Blocks() {
+			// never fails: bytes.Buffer
+			cw.StartBlock()
+			cw.Write(block)
+		}
+	}
+	return b.Bytes()
+}
+
+// Find returns the index of the file by the name, or -1.
+// The trailing spaces and the case are ignored.
+func (c *CAS) Find(name string) int {
+	name = strings.TrimRight(name, " ")
+	for i, f := range c.Files {
+		if f.Header != nil && strings.EqualFold(strings.TrimRight(f.Name, " "), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Add appends a file.
+func (c *CAS) Add(f *File) {
+	c.Files = append(c.Files, f)
+}
+
+// Delete removes the i-th file.
+func (c *CAS) Delete(i int) error {
+	if i < 0 || len(c.Files) <= i {
+		return fmt.Errorf("no file: %d", i)
+	}
+	c.Files = append(c.Files[0:i], c.Files[i+1:]...)
+	return nil
+}
+
+// Move moves the i-th file to the position to.
+func (c *CAS) Move(i, to int) error {
+	if i < 0 || len(c.Files) <= i {
+		return fmt.Errorf("no file: %d", i)
+	}
+	if to < 0 || len(c.Files) <= to {
+		return fmt.Errorf("invalid position: %d", to)
+	}
+	f := c.Files[i]
+	c.Files = append(c.Files[0:i], c.Files[i+1:]...)
+	c.Files = append(c.Files[0:to], append([]*File{f}, c.Files[to:]...)...)
+	return nil
+}
+
+// ValidateCAS checks the layout of a .CAS file and the files in it.
+func ValidateCAS(data []byte) []error {
+	var errs []error
+
+	// headers at the 8-byte boundary
+	first := -1
+	for pos := 0; ; pos++ {
+		i := bytes.Index(data[pos:], CASHeader)
+		if i < 0 {
+			break
+		}
+		pos += i
+		if first < 0 {
+			first = pos
+		}
+		if pos%8 != 0 {
+			errs = append(errs, fmt.Errorf("%04x: misaligned CAS header", pos))
+		}
+	}
+	if first < 0 {
+		return append(errs, fmt.Errorf("no CAS header"))
+	}
+	if first > 0 {
+		errs = append(errs, fmt.Errorf("0000: %d bytes before the first CAS header", first))
+	}
+
+	// files
+	for i, f := range Files(SplitCAS(data)) {
+		if f.Header == nil {
+			errs = append(errs, fmt.Errorf("%2d: block %d: no header", i, f.Index))
+			continue
+		}
+		if f.Data == nil {
+			errs = append(errs, fmt.Errorf("%2d: %s: no data", i, f.Name))
+			continue
+		}
+		switch f.Type {
+		case TypeBASIC:
+			_, err := ParseProgram(f.Data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%2d: %s: %w", i, f.Name, err))
+			}
+		case TypeASCII:
+			if bytes.IndexByte(f.Data, ASCIIEOF) < 0 {
+				errs = append(errs, fmt.Errorf("%2d: %s: no EOF", i, f.Name))
+			}
+		case TypeBinary:
+			_, _, err := ParseBinary(f.Data)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%2d: %s: %w", i, f.Name, err))
+			}
+		}
+	}
+	return errs
+}
@@ -0,0 +1,44 @@
+package msx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCASHeaderOnly(t *testing.T) {
+	// a header without data, then a binary file
+	var b bytes.Buffer
+	cw := NewCASWriter(&b)
+	for _, block := range [][]byte{
+		(&Header{Type: TypeBASIC, Name: "ORPHAN"}).Bytes(),
+		(&Header{Type: TypeBinary, Name: "DATA"}).Bytes(),
+		{0x00, 0xc0, 0x01, 0xc0, 0x00, 0xc0, 0xc9, 0xc9},
+	} {
+		cw.StartBlock()
+		cw.Write(block)
+	}
+
+	cas, err := ReadCAS(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cas.Files) != 2 || cas.Files[0].Data != nil {
+		t.Fatalf("files: %+v", cas.Files)
+	}
+	if blocks := cas.Files[0].Blocks(); len(blocks) != 1 {
+		t.Errorf("header only: %d blocks", len(blocks))
+	}
+
+	data := cas.Bytes()
+	if n := bytes.Count(data, CASHeader); n != 3 {
+		t.Errorf("%d CAS headers, want 3", n)
+	}
+	if !bytes.Equal(data, b.Bytes()) {
+		t.Errorf("rewritten:\n% x\nwant\n% x", data, b.Bytes())
+	}
+	errs := ValidateCAS(data)
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "no data") {
+		t.Errorf("validate: %v", errs)
+	}
+}
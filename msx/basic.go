@@ -0,0 +1,364 @@
+package msx
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// intermediate codes of MSX BASIC
+const (
+	codeEOL      = 0x00
+	codeGraphic  = 0x01 // graphic character: 1 byte
+	codeOct      = 0x0b // &O: 2 bytes
+	codeHex      = 0x0c // &H: 2 bytes
+	codeLinePtr  = 0x0d // pointer to a line: 2 bytes, only while running
+	codeLineNum  = 0x0e // line number: 2 bytes
+	codeInt8     = 0x0f // integer 10 - 255: 1 byte
+	codeInt0     = 0x11 // integer 0 - 9: 0x11 - 0x1A
+	codeInt16    = 0x1c // integer: 2 bytes
+	codeSingle   = 0x1d // single precision: 4 bytes BCD
+	codeDouble   = 0x1f // double precision: 8 bytes BCD
+	codeQuote    = 0x22
+	codeColon    = 0x3a
+	codeFunction = 0xff // prefix of functions
+
+	tokenFirst    = 0x81
+	tokenDATA     = 0x84
+	tokenREM      = 0x8f
+	tokenELSE     = 0xa1
+	tokenQuoteREM = 0xe6 // ' = :REM'
+	tokenMinus    = 0xf2
+
+	functionFirst = 0x81
+)
+
+// statements and operators: 0x81 - 0xFC
+var tokens = [...]string{
+	// 0x81
+	"END", "FOR", "NEXT", "DATA", "INPUT", "DIM", "READ",
+	"LET", "GOTO", "RUN", "IF", "RESTORE", "GOSUB", "RETURN", "REM",
+	// 0x90
+	"STOP", "PRINT", "CLEAR", "LIST", "NEW", "ON", "WAIT", "DEF",
+	"POKE", "CONT", "CSAVE", "CLOAD", "OUT", "LPRINT", "LLIST", "CLS",
+	// 0xA0
+	"WIDTH", "ELSE", "TRON", "TROFF", "SWAP", "ERASE", "ERROR", "RESUME",
+	"DELETE", "AUTO", "RENUM", "DEFSTR", "DEFINT", "DEFSNG", "DEFDBL", "LINE",
+	// 0xB0
+	"OPEN", "FIELD", "GET", "PUT", "CLOSE", "LOAD", "MERGE", "FILES",
+	"LSET", "RSET", "SAVE", "LFILES", "CIRCLE", "COLOR", "DRAW", "PAINT",
+	// 0xC0
+	"BEEP", "PLAY", "PSET", "PRESET", "SOUND", "SCREEN", "VPOKE", "SPRITE",
+	"VDP", "BASE", "CALL", "TIME", "KEY", "MAX", "MOTOR", "BLOAD",
+	// 0xD0
+	"BSAVE", "DSKO$", "SET", "NAME", "KILL", "IPL", "COPY", "CMD",
+	"LOCATE", "TO", "THEN", "TAB(", "STEP", "USR", "FN", "SPC(",
+	// 0xE0
+	"NOT", "ERL", "ERR", "STRING$", "USING", "INSTR", "'", "VARPTR",
+	"CSRLIN", "ATTR$", "DSKI$", "OFF", "INKEY$", "POINT", ">", "=",
+	// 0xF0
+	"<", "+", "-", "*", "/", "^", "AND", "OR",
+	"XOR", "EQV", "IMP", "MOD", "\\",
+}
+
+// functions: 0xFF + 0x81 - 0xB0
+var functions = [...]string{
+	// 0x81
+	"LEFT$", "RIGHT$", "MID$", "SGN", "INT", "ABS", "SQR",
+	"RND", "SIN", "LOG", "EXP", "COS", "TAN", "ATN", "FRE",
+	// 0x90
+	"INP", "POS", "LEN", "STR$", "VAL", "ASC", "CHR$", "PEEK",
+	"VPEEK", "SPACE$", "OCT$", "HEX$", "LPOS", "BIN$", "CINT", "CSNG",
+	// 0xA0
+	"CDBL", "FIX", "STICK", "STRIG", "PDL", "PAD", "DSKF", "FPOS",
+	"CVI", "CVS", "CVD", "EOF", "LOC", "LOF", "MKI$", "MKS$",
+	// 0xB0
+	"MKD$",
+}
+
+// Line of a BASIC program.
+//
+//	link:   2 bytes, address of the next line, 0x0000 for the end
+//	number: 2 bytes
+//	body:   N bytes
+//	EOL:    0x00
+type Line struct {
+	Number uint16
+	Body   []byte
+}
+
+// ParseProgram splits tokenized BASIC code (CSAVE) into lines by the link pointers.
+// The files saved to disks start with 0xFF.
+func ParseProgram(data []byte) ([]Line, error) {
+	if len(data) > 0 && data[0] == 0xff {
+		data = data[1:]
+	}
+
+	var lines []Line
+	base := -1 // address of data[0]
+	for pos := 0; pos+2 <= len(data); {
+		link := int(data[pos]) | int(data[pos+1])<<8
+		if link == 0 {
+			// end mark
+			return lines, nil
+		}
+		if pos+4 > len(data) {
+			return lines, errors.New("short line header")
+		}
+		eol := lineEnd(data, pos+4)
+		if eol >= len(data) {
+			return lines, errors.New("no EOL")
+		}
+		if base < 0 {
+			base = link - (eol + 1)
+		}
+		lines = append(lines, Line{
+			Number: uint16(data[pos+2]) | uint16(data[pos+3])<<8,
+			Body:   data[pos+4 : eol],
+		})
+
+		// next line
+		next := link - base
+		if next != eol+1 {
+			return lines, fmt.Errorf("broken link: %04x", link)
+		}
+		pos = next
+	}
+	return lines, errors.New("no end mark")
+}
+
+// operandSize returns the size of the operand of the code.
+func operandSize(c byte) int {
+	switch c {
+	case codeOct, codeHex, codeLinePtr, codeLineNum, codeInt16:
+		return 2
+	case codeInt8:
+		return 1
+	case codeSingle:
+		return 4
+	case codeDouble:
+		return 8
+	}
+	return 0
+}
+
+// lineEnd returns the position of EOL.
+// The operands of the numbers may contain 0x00.
+func lineEnd(data []byte, pos int) int {
+	inString := false
+	inData := false
+	for ; pos < len(data); pos++ {
+		c := data[pos]
+		switch {
+		case c == codeEOL:
+			return pos
+		case inString:
+			inString = c != codeQuote
+		case c == codeQuote:
+			inString = true
+		case inData:
+			inData = c != codeColon
+		case c == tokenDATA:
+			inData = true
+		case c == tokenREM:
+			// comment
+			for pos < len(data) && data[pos] != codeEOL {
+				pos++
+			}
+			return pos
+		case c == codeFunction:
+			pos++
+		default:
+			pos += operandSize(c)
+		}
+	}
+	return pos
+}
+
+// rawChar converts a character in strings, DATA and REM.
+func rawChar(body []byte, i *int) string {
+	c := body[*i]
+	if c == codeGraphic && *i+1 < len(body) {
+		*i++
+		return GraphicToString(body[*i])
+	}
+	return CharToString(c)
+}
+
+// Detokenize converts the body of a line to text as LIST.
+func Detokenize(body []byte) (string, error) {
+	var sb strings.Builder
+
+	inString := false
+	inData := false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		if c == codeEOL {
+			break
+		}
+
+		// raw characters
+		if inString {
+			if c == codeQuote {
+				inString = false
+			}
+			sb.WriteString(rawChar(body, &i))
+			continue
+		}
+		if inData && c != codeColon {
+			if c == codeQuote {
+				inString = true
+			}
+			sb.WriteString(rawChar(body, &i))
+			continue
+		}
+		inData = false
+
+		// operands
+		size := operandSize(c)
+		if i+size >= len(body) {
+			return sb.String(), fmt.Errorf("short operand: %02x", c)
+		}
+		operand := body[i+1 : i+1+size]
+		i += size
+
+		switch {
+		case c == codeOct:
+			fmt.Fprintf(&sb, "&O%o", uint16(operand[0])|uint16(operand[1])<<8)
+		case c == codeHex:
+			fmt.Fprintf(&sb, "&H%X", uint16(operand[0])|uint16(operand[1])<<8)
+		case c == codeLinePtr:
+			fmt.Fprintf(&sb, "{%02X}{%02X}{%02X}", c, operand[0], operand[1])
+		case c == codeLineNum:
+			fmt.Fprintf(&sb, "%d", uint16(operand[0])|uint16(operand[1])<<8)
+		case c == codeInt8:
+			fmt.Fprintf(&sb, "%d", operand[0])
+		case codeInt0 <= c && c < codeInt0+10:
+			fmt.Fprintf(&sb, "%d", c-codeInt0)
+		case c == codeInt16:
+			fmt.Fprintf(&sb, "%d", int16(uint16(operand[0])|uint16(operand[1])<<8))
+		case c == codeSingle || c == codeDouble:
+			sb.WriteString(formatBCD(operand, c == codeDouble))
+		case c == codeQuote:
+			inString = true
+			sb.WriteString(CharToString(c))
+		case c == codeColon && i+1 < len(body) && body[i+1] == tokenELSE:
+			// ELSE is saved as :ELSE
+		case c == codeColon && i+2 < len(body) && body[i+1] == tokenREM && body[i+2] == tokenQuoteREM:
+			// ' is saved as :REM'
+			i += 2
+			sb.WriteString(tokens[tokenQuoteREM-tokenFirst])
+			return comment(&sb, body[i+1:]), nil
+		case c == codeFunction:
+			if i+1 >= len(body) || body[i+1] < functionFirst || int(body[i+1]-functionFirst) >= len(functions) {
+				return sb.String(), fmt.Errorf("invalid function: %02x", body[i:])
+			}
+			i++
+			sb.WriteString(functions[body[i]-functionFirst])
+		case c >= tokenFirst && int(c-tokenFirst) < len(tokens):
+			sb.WriteString(tokens[c-tokenFirst])
+			if c == tokenREM {
+				return comment(&sb, body[i+1:]), nil
+			}
+			if c == tokenDATA {
+				inData = true
+			}
+		case 0x20 <= c && c < 0x7f:
+			sb.WriteString(CharToString(c))
+		default:
+			fmt.Fprintf(&sb, "{%02X}", c)
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// comment converts the rest of the line after REM.
+func comment(sb *strings.Builder, body []byte) string {
+	for i := 0; i < len(body); i++ {
+		if body[i] == codeEOL {
+			break
+		}
+		sb.WriteString(rawChar(body, &i))
+	}
+	return sb.String()
+}
+
+// formatBCD converts a floating point number to text as LIST.
+//
+//	byte 0:   sign (bit 7) and exponent (bit 0-6, excess 0x40)
+//	byte 1- : mantissa, 2 digits BCD per byte: 0.dddddd x 10^exponent
+func formatBCD(b []byte, double bool) string {
+	suffix, expChar, maxDigits := "!", "E", 6
+	if double {
+		suffix, expChar, maxDigits = "#", "D", 14
+	}
+	if b[0]&0x7f == 0 {
+		return "0" + suffix
+	}
+
+	var digits []byte
+	for _, d := range b[1:] {
+		digits = append(digits, '0'+d>>4, '0'+d&0x0f)
+	}
+	n := len(digits)
+	for n > 1 && digits[n-1] == '0' {
+		n--
+	}
+	ds := string(digits[0:n])
+	exp := int(b[0]&0x7f) - 0x40
+
+	sign := ""
+	if b[0]&0x80 != 0 {
+		sign = "-"
+	}
+
+	// exponential notation
+	if exp < -1 || exp > maxDigits {
+		s := ds[0:1]
+		if n > 1 {
+			s += "." + ds[1:]
+		}
+		e := exp - 1
+		esign := "+"
+		if e < 0 {
+			esign = "-"
+			e = -e
+		}
+		return fmt.Sprintf("%s%s%s%s%02d", sign, s, expChar, esign, e)
+	}
+
+	// fixed notation
+	var s string
+	switch {
+	case exp <= 0:
+		s = "." + strings.Repeat("0", -exp) + ds
+	case exp < n:
+		s = ds[0:exp] + "." + ds[exp:]
+	default:
+		s = ds + strings.Repeat("0", exp-n)
+	}
+	if double {
+		// the default type of MSX BASIC is double precision,
+		// the suffix is needed only for the numbers in the integer range.
+		if v, err := strconv.Atoi(s); err != nil || v > 32767 {
+			suffix = ""
+		}
+	}
+	return sign + s + suffix
+}
+
+// List converts a tokenized BASIC program to text.
+func List(data []byte) (string, error) {
+	lines, err := ParseProgram(data)
+	var sb strings.Builder
+	for _, l := range lines {
+		txt, err := Detokenize(l.Body)
+		fmt.Fprintf(&sb, "%d %s\n", l.Number, txt)
+		if err != nil {
+			return sb.String(), fmt.Errorf("line %d: %w", l.Number, err)
+		}
+	}
+	return sb.String(), err
+}
@@ -0,0 +1,66 @@
+package msx
+
+// entry points of MSX BIOS and the system work area
+var BIOSLabels = map[uint16]string{
+	// RST
+	0x0000: "CHKRAM", 0x0008: "SYNCHR", 0x0010: "CHRGTR", 0x0018: "OUTDO",
+	0x0020: "DCOMPR", 0x0028: "GETYPR", 0x0030: "CALLF", 0x0038: "KEYINT",
+
+	// slots
+	0x000c: "RDSLT", 0x0014: "WRSLT", 0x001c: "CALSLT", 0x0024: "ENASLT",
+
+	// I/O initialization
+	0x003b: "INITIO", 0x003e: "INIFNK",
+
+	// VDP
+	0x0041: "DISSCR", 0x0044: "ENASCR", 0x0047: "WRTVDP", 0x004a: "RDVRM",
+	0x004d: "WRTVRM", 0x0050: "SETRD", 0x0053: "SETWRT", 0x0056: "FILVRM",
+	0x0059: "LDIRMV", 0x005c: "LDIRVM", 0x005f: "CHGMOD", 0x0062: "CHGCLR",
+	0x0066: "NMI", 0x0069: "CLRSPR", 0x006c: "INITXT", 0x006f: "INIT32",
+	0x0072: "INIGRP", 0x0075: "INIMLT", 0x0078: "SETTXT", 0x007b: "SETT32",
+	0x007e: "SETGRP", 0x0081: "SETMLT", 0x0084: "CALPAT", 0x0087: "CALATR",
+	0x008a: "GSPSIZ", 0x008d: "GRPPRT",
+
+	// PSG
+	0x0090: "GICINI", 0x0093: "WRTPSG", 0x0096: "RDPSG", 0x0099: "STRTMS",
+
+	// console
+	0x009c: "CHSNS", 0x009f: "CHGET", 0x00a2: "CHPUT", 0x00a5: "LPTOUT",
+	0x00a8: "LPTSTT", 0x00ab: "CNVCHR", 0x00ae: "PINLIN", 0x00b1: "INLIN",
+	0x00b4: "QINLIN", 0x00b7: "BREAKX", 0x00ba: "ISCNTC", 0x00bd: "CKCNTC",
+	0x00c0: "BEEP", 0x00c3: "CLS", 0x00c6: "POSIT", 0x00c9: "FNKSB",
+	0x00cc: "ERAFNK", 0x00cf: "DSPFNK", 0x00d2: "TOTEXT",
+
+	// controllers
+	0x00d5: "GTSTCK", 0x00d8: "GTTRIG", 0x00db: "GTPAD", 0x00de: "GTPDL",
+
+	// cassette
+	0x00e1: "TAPION", 0x00e4: "TAPIN", 0x00e7: "TAPIOF", 0x00ea: "TAPOON",
+	0x00ed: "TAPOUT", 0x00f0: "TAPOOF", 0x00f3: "STMOTR",
+
+	// queues & graphics
+	0x00f6: "LFTQ", 0x00f9: "PUTQ", 0x00fc: "RIGHTC", 0x00ff: "LEFTC",
+	0x0102: "UPC", 0x0105: "TUPC", 0x0108: "DOWNC", 0x010b: "TDOWNC",
+	0x010e: "SCALXY", 0x0111: "MAPXY", 0x0114: "FETCHC", 0x0117: "STOREC",
+	0x011a: "SETATR", 0x011d: "READC", 0x0120: "SETC", 0x0123: "NSETCX",
+	0x0126: "GTASPC", 0x0129: "PNTINI", 0x012c: "SCANR", 0x012f: "SCANL",
+
+	// misc
+	0x0132: "CHGCAP", 0x0135: "CHGSND", 0x0138: "RSLREG", 0x013b: "WSLREG",
+	0x013e: "RDVDP", 0x0141: "SNSMAT", 0x0144: "PHYDIO", 0x0147: "FORMAT",
+	0x014a: "ISFLIO", 0x014d: "OUTDLP", 0x0150: "GETVCP", 0x0153: "GETVC2",
+	0x0156: "KILBUF", 0x0159: "CALBAS",
+
+	// MSX2 and later
+	0x015c: "SUBROM", 0x015f: "EXTROM", 0x0162: "CHKSLZ", 0x0165: "CHKNEW",
+	0x0168: "EOL", 0x016b: "BIGFIL", 0x016e: "NSETRD", 0x0171: "NSTWRT",
+	0x0174: "NRDVRM", 0x0177: "NWRVRM", 0x0180: "CHGCPU", 0x0183: "GETCPU",
+	0x0186: "PCMPLY", 0x0189: "PCMREC",
+
+	// system work area
+	0xf3ae: "LINL40", 0xf3af: "LINL32", 0xf3b0: "LINLEN", 0xf3db: "CLIKSW",
+	0xf3dc: "CSRY", 0xf3dd: "CSRX", 0xf3df: "RG0SAV", 0xf3e7: "STATFL",
+	0xf3e9: "FORCLR", 0xf3ea: "BAKCLR", 0xf3eb: "BDRCLR", 0xf676: "TXTTAB",
+	0xfc48: "BOTTOM", 0xfc4a: "HIMEM", 0xfc9e: "JIFFY", 0xfcaf: "SCRMOD",
+	0xfcc1: "EXPTBL", 0xfd9a: "H.KEYI", 0xfd9f: "H.TIMI",
+}
@@ -0,0 +1,56 @@
+package msx
+
+import (
+	"fmt"
+)
+
+// BinHeader is the header of the machine code (BSAVE).
+//
+//	start: 2 bytes
+//	end:   2 bytes
+//	exec:  2 bytes
+//	code:  end - start + 1 bytes
+type BinHeader struct {
+	Start uint16
+	End   uint16
+	Exec  uint16
+}
+
+const BinHeaderLen = 6
+
+// ParseBinary parses the data of a binary file: the header and the machine code.
+// The files saved to disks start with 0xFE.
+func ParseBinary(data []byte) (*BinHeader, []byte, error) {
+	if len(data) > BinHeaderLen && data[0] == 0xfe {
+		// the size of the disk file is exact
+		h := parseBinHeader(data[1:])
+		if int(h.End)-int(h.Start)+1 == len(data)-1-BinHeaderLen {
+			data = data[1:]
+		}
+	}
+	if len(data) < BinHeaderLen {
+		return nil, nil, fmt.Errorf("invalid binary length: %d", len(data))
+	}
+	h := parseBinHeader(data)
+	if h.End < h.Start {
+		return h, nil, fmt.Errorf("invalid address: %04x - %04x", h.Start, h.End)
+	}
+	code := data[BinHeaderLen:]
+	size := int(h.End-h.Start) + 1
+	if len(code) < size {
+		return h, code, fmt.Errorf("short code: %d < %d", len(code), size)
+	}
+	return h, code[0:size], nil
+}
+
+func parseBinHeader(data []byte) *BinHeader {
+	return &BinHeader{
+		Start: uint16(data[0]) | uint16(data[1])<<8,
+		End:   uint16(data[2]) | uint16(data[3])<<8,
+		Exec:  uint16(data[4]) | uint16(data[5])<<8,
+	}
+}
+
+func (h *BinHeader) String() string {
+	return fmt.Sprintf("start:%04X end:%04X exec:%04X", h.Start, h.End, h.Exec)
+}
@@ -0,0 +1,55 @@
+package msx
+
+import (
+	"bytes"
+	"io"
+)
+
+// CASHeader is the header of a block in .CAS files.
+// It is placed at the 8-byte boundary, instead of the leader (sync) of the tape.
+var CASHeader = []byte{0x1f, 0xa6, 0xde, 0xba, 0xcc, 0x13, 0x7d, 0x74}
+
+// CASWriter writes the blocks as a .CAS file.
+type CASWriter struct {
+	w   io.Writer
+	pos int64
+}
+
+// NewCASWriter returns a CASWriter.
+func NewCASWriter(w io.Writer) *CASWriter {
+	return &CASWriter{w: w}
+}
+
+// StartBlock pads the previous block by 0x00 to the 8-byte boundary and writes the header.
+func (cw *CASWriter) StartBlock() error {
+	pad := (8 - cw.pos%8) % 8
+	_, err := cw.Write(append(make([]byte, pad), CASHeader...))
+	return err
+}
+
+// Write writes the data of the current block.
+func (cw *CASWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.pos += int64(n)
+	return n, err
+}
+
+// SplitCAS splits a .CAS file into the blocks.
+// The padding to the next header remains at the end of the blocks.
+func SplitCAS(cas []byte) [][]byte {
+	var blocks [][]byte
+	start := -1
+	for pos := 0; pos+len(CASHeader) <= len(cas); pos += 8 {
+		if !bytes.Equal(cas[pos:pos+len(CASHeader)], CASHeader) {
+			continue
+		}
+		if start >= 0 {
+			blocks = append(blocks, cas[start:pos])
+		}
+		start = pos + len(CASHeader)
+	}
+	if start >= 0 {
+		blocks = append(blocks, cas[start:])
+	}
+	return blocks
+}
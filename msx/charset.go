@@ -0,0 +1,106 @@
+package msx
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf8"
+)
+
+// character set of Japanese MSX
+
+// graphic characters: 0x01 + 0x40 - 0x5F
+var graphics40 = [0x20]rune{
+	'　', '月', '火', '水', '木', '金', '土', '日', '年', '円', '時', '分', '秒', '百', '千', '万',
+	'π', '┴', '┬', '┤', '├', '┼', '│', '─', '┌', '┐', '└', '┘', '╳', '大', '中', '小',
+}
+
+// graphic characters and hiragana: 0x80 - 0x9F
+var chars80 = [0x20]rune{
+	'♠', '♥', '♣', '♦', '○', '●', 'を', 'ぁ', 'ぃ', 'ぅ', 'ぇ', 'ぉ', 'ゃ', 'ゅ', 'ょ', 'っ',
+	'　', 'あ', 'い', 'う', 'え', 'お', 'か', 'き', 'く', 'け', 'こ', 'さ', 'し', 'す', 'せ', 'そ',
+}
+
+// hiragana: 0xE0 - 0xFD
+var charsE0 = [0x1e]rune{
+	'た', 'ち', 'つ', 'て', 'と', 'な', 'に', 'ぬ', 'ね', 'の', 'は', 'ひ', 'ふ', 'へ', 'ほ', 'ま',
+	'み', 'む', 'め', 'も', 'や', 'ゆ', 'よ', 'ら', 'り', 'る', 'れ', 'ろ', 'わ', 'ん',
+}
+
+// CharToString converts a character code of MSX to a unicode string.
+// Unknown codes are escaped as "{XX}".
+func CharToString(c byte) string {
+	switch {
+	case c == 0x5c:
+		return "¥"
+	case 0x20 <= c && c < 0x7f:
+		return string(rune(c))
+	case 0x80 <= c && c < 0xa0:
+		return string(chars80[c-0x80])
+	case c == 0xa0:
+		// blank, distinct from the space
+		return "\u00a0"
+	case 0xa1 <= c && c < 0xe0:
+		// katakana: JIS X 0201
+		return string(rune(0xff61 + int(c) - 0xa1))
+	case 0xe0 <= c && c < 0xfe:
+		return string(charsE0[c-0xe0])
+	}
+	return fmt.Sprintf("{%02X}", c)
+}
+
+// GraphicToString converts a graphic character (0x01 + code) to a unicode string.
+func GraphicToString(c byte) string {
+	if 0x40 <= c && c < 0x60 {
+		return string(graphics40[c-0x40])
+	}
+	return fmt.Sprintf("{01}{%02X}", c)
+}
+
+// StringToChars converts a unicode string to character codes of MSX.
+// It's the reverse of CharToString and GraphicToString, the backslash is also converted to 0x5C.
+func StringToChars(s string) ([]byte, error) {
+	ret := make([]byte, 0, len(s))
+	for len(s) > 0 {
+		if s[0] == '{' && len(s) >= 4 && s[3] == '}' {
+			c, err := strconv.ParseUint(s[1:3], 16, 8)
+			if err == nil {
+				ret = append(ret, byte(c))
+				s = s[4:]
+				continue
+			}
+		}
+
+		r, size := utf8.DecodeRuneInString(s)
+		c, ok := charCodes[r]
+		if !ok {
+			return nil, fmt.Errorf("unknown character: %q", r)
+		}
+		ret = append(ret, c...)
+		s = s[size:]
+	}
+	return ret, nil
+}
+
+var charCodes = func() map[rune][]byte {
+	m := make(map[rune][]byte)
+	for c := 0x20; c < 0x100; c++ {
+		s := CharToString(byte(c))
+		if s == fmt.Sprintf("{%02X}", c) {
+			// unknown code
+			continue
+		}
+		// the first code wins
+		r := []rune(s)[0]
+		if _, ok := m[r]; !ok {
+			m[r] = []byte{byte(c)}
+		}
+	}
+	for c := 0x40; c < 0x60; c++ {
+		r := graphics40[c-0x40]
+		if _, ok := m[r]; !ok {
+			m[r] = []byte{codeGraphic, byte(c)}
+		}
+	}
+	m['\\'] = []byte{0x5c}
+	return m
+}()
@@ -0,0 +1,38 @@
+package msx
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStringToChars(t *testing.T) {
+	for c := 0; c < 0x100; c++ {
+		s := CharToString(byte(c))
+		got, err := StringToChars(s)
+		if err != nil {
+			t.Errorf("%02x: %q: %v", c, s, err)
+			continue
+		}
+		if !bytes.Equal(got, []byte{byte(c)}) {
+			t.Errorf("%02x: %q: got % x", c, s, got)
+		}
+	}
+
+	// graphic characters
+	for c := 0x40; c < 0x60; c++ {
+		s := GraphicToString(byte(c))
+		got, err := StringToChars(s)
+		if err != nil {
+			t.Errorf("01 %02x: %q: %v", c, s, err)
+			continue
+		}
+		want := []byte{codeGraphic, byte(c)}
+		if s == CharToString(0x90) {
+			// the same as the hiragana space
+			want = []byte{0x90}
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("01 %02x: %q: got % x, want % x", c, s, got, want)
+		}
+	}
+}
@@ -0,0 +1,2 @@
+// MSX
+package msx
@@ -0,0 +1,252 @@
+package msx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MSX-DOS disk image: 720KB 2DD, FAT12
+//
+//	sector 0:      boot sector
+//	sector 1-3:    FAT 1
+//	sector 4-6:    FAT 2
+//	sector 7-13:   root directory, 112 entries
+//	sector 14-:    data, 2 sectors/cluster
+const (
+	SectorSize        = 512
+	dskSectors        = 1440
+	dskSectorsPerClus = 2
+	dskFATSectors     = 3
+	dskFATs           = 2
+	dskRootEntries    = 112
+	dskMedia          = 0xf9
+
+	dskFATStart  = 1
+	dskRootStart = dskFATStart + dskFATs*dskFATSectors
+	dskDataStart = dskRootStart + dskRootEntries*32/SectorSize
+	dskClusters  = (dskSectors - dskDataStart) / dskSectorsPerClus
+	dskClusSize  = dskSectorsPerClus * SectorSize
+
+	DSKSize = dskSectors * SectorSize
+)
+
+// Disk is an MSX-DOS disk image.
+type Disk struct {
+	img   []byte
+	files int
+	next  int // next free cluster
+	time  time.Time
+	names map[string]bool
+}
+
+// DOSEpoch is the oldest time stamp of MSX-DOS.
+var DOSEpoch = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// NewDisk returns a formatted disk image.
+// t is the time stamp of the files, the same t makes the same image.
+func NewDisk(t time.Time) *Disk {
+	if t.Before(DOSEpoch) {
+		t = DOSEpoch
+	}
+	d := &Disk{
+		img:   make([]byte, DSKSize),
+		next:  2,
+		time:  t,
+		names: make(map[string]bool),
+	}
+
+	// boot sector
+	boot := d.img[0:SectorSize]
+	copy(boot, []byte{0xeb, 0xfe, 0x90})
+	copy(boot[3:], "CMTTOOLS")
+	bpb := struct {
+		BytesPerSector    uint16
+		SectorsPerCluster byte
+		ReservedSectors   uint16
+		FATs              byte
+		RootEntries       uint16
+		Sectors           uint16
+		Media             byte
+		SectorsPerFAT     uint16
+		SectorsPerTrack   uint16
+		Heads             uint16
+		HiddenSectors     uint16
+	}{SectorSize, dskSectorsPerClus, dskFATStart, dskFATs, dskRootEntries, dskSectors, dskMedia, dskFATSectors, 9, 2, 0}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, &bpb)
+	copy(boot[0x0b:], b.Bytes())
+	// no system: the boot routine returns
+	boot[0x1e] = 0xc9
+
+	// FAT: media descriptor
+	d.setFAT(0, 0xf00|dskMedia)
+	d.setFAT(1, 0xfff)
+	return d
+}
+
+// setFAT sets the entry of both FATs.
+func (d *Disk) setFAT(n int, v uint16) {
+	for f := 0; f < dskFATs; f++ {
+		fat := d.img[(dskFATStart+f*dskFATSectors)*SectorSize:]
+		off := n * 3 / 2
+		if n%2 == 0 {
+			fat[off] = byte(v)
+			fat[off+1] = fat[off+1]&0xf0 | byte(v>>8)&0x0f
+		} else {
+			fat[off] = fat[off]&0x0f | byte(v<<4)
+			fat[off+1] = byte(v >> 4)
+		}
+	}
+}
+
+// DOSName converts a name to 8.3 format: "NAME    EXT".
+func DOSName(name, ext string) string {
+	conv := func(s string, n int) string {
+		s = strings.ToUpper(strings.TrimSpace(s))
+		ret := []byte(strings.Repeat(" ", n))
+		j := 0
+		for i := 0; i < len(s) && j < n; i++ {
+			c := s[i]
+			switch {
+			case c == ' ':
+				continue
+			case c < 0x20 || c >= 0x7f || strings.IndexByte(`."/\[]:;=,*?<>|+`, c) >= 0:
+				c = '_'
+			}
+			ret[j] = c
+			j++
+		}
+		return string(ret)
+	}
+	base := conv(name, 8)
+	if strings.TrimSpace(base) == "" {
+		base = "NONAME  "
+	}
+	return base + conv(strings.TrimPrefix(ext, "."), 3)
+}
+
+// AddFile writes a file to the root directory.
+// The name is changed if the same name exists. It returns the name on the disk: "NAME.EXT".
+func (d *Disk) AddFile(name, ext string, data []byte) (string, error) {
+	if d.files >= dskRootEntries {
+		return "", errors.New("root directory is full")
+	}
+	clusters := (len(data) + dskClusSize - 1) / dskClusSize
+	if d.next+clusters > dskClusters+2 {
+		return "", errors.New("disk full")
+	}
+
+	// unique name
+	orig := DOSName(name, ext)
+	dosName := orig
+	for i := 1; d.names[dosName]; i++ {
+		if i > 9 {
+			return "", fmt.Errorf("too many files: %s", orig)
+		}
+		// NAME -> NAME1, NAME2, ...
+		base := []byte(orig[0:8])
+		end := bytes.IndexByte(base, ' ')
+		if end < 0 {
+			end = 7
+		}
+		base[end] = byte('0' + i)
+		dosName = string(base) + orig[8:]
+	}
+	d.names[dosName] = true
+
+	// data & FAT
+	first := 0
+	if clusters > 0 {
+		first = d.next
+	}
+	for i := 0; i < clusters; i++ {
+		c := d.next + i
+		copy(d.img[(dskDataStart+(c-2)*dskSectorsPerClus)*SectorSize:], data[i*dskClusSize:])
+		if i == clusters-1 {
+			d.setFAT(c, 0xfff)
+		} else {
+			d.setFAT(c, uint16(c+1))
+		}
+	}
+	d.next += clusters
+
+	// directory entry
+	t := d.time
+	entry := d.img[dskRootStart*SectorSize+d.files*32:]
+	copy(entry[0:11], dosName)
+	entry[11] = 0x20 // archive
+	binary.LittleEndian.PutUint16(entry[22:], uint16(t.Hour()<<11|t.Minute()<<5|t.Second()/2))
+	binary.LittleEndian.PutUint16(entry[24:], uint16((t.Year()-1980)<<9|int(t.Month())<<5|t.Day()))
+	binary.LittleEndian.PutUint16(entry[26:], uint16(first))
+	binary.LittleEndian.PutUint32(entry[28:], uint32(len(data)))
+	d.files++
+
+	return strings.TrimSpace(dosName[0:8]) + "." + strings.TrimSpace(dosName[8:]), nil
+}
+
+// Bytes returns the disk image.
+func (d *Disk) Bytes() []byte {
+	return d.img
+}
+
+// DiskData converts the data on tape to the file on disk.
+//
+//	BASIC:  0xFF + program
+//	ASCII:  text until EOF (0x1A)
+//	binary: 0xFE + header + code
+func (f *File) DiskData() ([]byte, error) {
+	if f.Header == nil {
+		return f.Data, nil
+	}
+	switch f.Type {
+	case TypeBASIC:
+		return append([]byte{0xff}, f.Data...), nil
+	case TypeASCII:
+		if i := bytes.IndexByte(f.Data, ASCIIEOF); i >= 0 {
+			return f.Data[0 : i+1], nil
+		}
+		return append(append([]byte(nil), f.Data...), ASCIIEOF), nil
+	}
+	h, code, err := ParseBinary(f.Data)
+	if err != nil {
+		return nil, err
+	}
+	data := []byte{0xfe}
+	data = binary.LittleEndian.AppendUint16(data, h.Start)
+	data = binary.LittleEndian.AppendUint16(data, h.End)
+	data = binary.LittleEndian.AppendUint16(data, h.Exec)
+	return append(data, code...), nil
+}
+
+// Autoexec returns AUTOEXEC.BAS (ASCII) to run the files.
+// If there are more than one file, it shows a menu.
+// names are "NAME.EXT" on the disk.
+func Autoexec(names []string, types []FileType) []byte {
+	run := func(name string, t FileType) string {
+		if t == TypeBinary {
+			return fmt.Sprintf("BLOAD \"%s\",R", name)
+		}
+		return fmt.Sprintf("RUN \"%s\"", name)
+	}
+
+	var sb strings.Builder
+	if len(names) == 1 {
+		fmt.Fprintf(&sb, "10 %s\r\n", run(names[0], types[0]))
+	} else {
+		sb.WriteString("10 CLS\r\n")
+		for i, n := range names {
+			fmt.Fprintf(&sb, "%d PRINT \"%d: %s\"\r\n", 20+i, i+1, n)
+		}
+		fmt.Fprintf(&sb, "%d INPUT \"NO\";N\r\n", 20+len(names))
+		for i, n := range names {
+			fmt.Fprintf(&sb, "%d IF N=%d THEN %s\r\n", 1000+i*10, i+1, run(n, types[i]))
+		}
+		fmt.Fprintf(&sb, "%d GOTO 10\r\n", 1000+len(names)*10)
+	}
+	sb.WriteByte(ASCIIEOF)
+	return []byte(sb.String())
+}
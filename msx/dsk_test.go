@@ -0,0 +1,161 @@
+package msx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// fat12 returns the n-th entry of a FAT.
+func fat12(fat []byte, n int) uint16 {
+	off := n * 3 / 2
+	if n%2 == 0 {
+		return uint16(fat[off]) | uint16(fat[off+1]&0x0f)<<8
+	}
+	return uint16(fat[off]>>4) | uint16(fat[off+1])<<4
+}
+
+func TestDisk(t *testing.T) {
+	stamp := time.Date(2024, 5, 6, 7, 8, 10, 0, time.UTC)
+	big := bytes.Repeat([]byte{0x55}, 1500) // 2 clusters
+	build := func() (*Disk, []string) {
+		d := NewDisk(stamp)
+		var names []string
+		for _, f := range []struct {
+			name, ext string
+			data      []byte
+		}{
+			{"hello", "bas", big},
+			{"hello", ".bas", []byte{1, 2, 3}},
+			{"LONGNAME", "BIN", nil},
+			{"LONGNAMES", "BIN", []byte{4}},
+		} {
+			n, err := d.AddFile(f.name, f.ext, f.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, n)
+		}
+		return d, names
+	}
+	d, names := build()
+	img := d.Bytes()
+	if len(img) != DSKSize {
+		t.Fatalf("size: %d", len(img))
+	}
+
+	// the same files make the same image
+	if d2, _ := build(); !bytes.Equal(d2.Bytes(), img) {
+		t.Errorf("not reproducible")
+	}
+
+	// BPB
+	for _, tt := range []struct {
+		off  int
+		size int
+		want int
+	}{
+		{0x0b, 2, 512}, {0x0d, 1, 2}, {0x0e, 2, 1}, {0x10, 1, 2}, {0x11, 2, 112},
+		{0x13, 2, 1440}, {0x15, 1, 0xf9}, {0x16, 2, 3}, {0x18, 2, 9}, {0x1a, 2, 2},
+	} {
+		got := int(img[tt.off])
+		if tt.size == 2 {
+			got = int(binary.LittleEndian.Uint16(img[tt.off:]))
+		}
+		if got != tt.want {
+			t.Errorf("BPB %02x: got %d, want %d", tt.off, got, tt.want)
+		}
+	}
+
+	// FAT: both copies, odd and even entries
+	fat1 := img[1*SectorSize : 4*SectorSize]
+	fat2 := img[4*SectorSize : 7*SectorSize]
+	if !bytes.Equal(fat1, fat2) {
+		t.Errorf("FATs differ")
+	}
+	for n, want := range []uint16{0xff9, 0xfff, 3, 0xfff, 0xfff, 0xfff, 0} {
+		if got := fat12(fat1, n); got != want {
+			t.Errorf("FAT %d: got %03x, want %03x", n, got, want)
+		}
+	}
+
+	// directory
+	wantNames := []string{"HELLO.BAS", "HELLO1.BAS", "LONGNAME.BIN", "LONGNAM1.BIN"}
+	for i, want := range []struct {
+		name    string
+		cluster uint16
+		size    uint32
+	}{
+		{"HELLO   BAS", 2, 1500},
+		{"HELLO1  BAS", 4, 3},
+		{"LONGNAMEBIN", 0, 0},
+		{"LONGNAM1BIN", 5, 1},
+	} {
+		if names[i] != wantNames[i] {
+			t.Errorf("%d: name %q, want %q", i, names[i], wantNames[i])
+		}
+		e := img[7*SectorSize+i*32:]
+		if string(e[0:11]) != want.name || e[11] != 0x20 {
+			t.Errorf("%d: entry %q %02x", i, e[0:11], e[11])
+		}
+		if c := binary.LittleEndian.Uint16(e[26:]); c != want.cluster {
+			t.Errorf("%d: cluster %d, want %d", i, c, want.cluster)
+		}
+		if s := binary.LittleEndian.Uint32(e[28:]); s != want.size {
+			t.Errorf("%d: size %d, want %d", i, s, want.size)
+		}
+		if tm, dt := binary.LittleEndian.Uint16(e[22:]), binary.LittleEndian.Uint16(e[24:]); tm != 7<<11|8<<5|5 || dt != 44<<9|5<<5|6 {
+			t.Errorf("%d: time %04x, date %04x", i, tm, dt)
+		}
+	}
+
+	// data: cluster 2 is sector 14
+	data := img[14*SectorSize:]
+	if !bytes.Equal(data[0:1500], big) || data[1500] != 0 || !bytes.Equal(data[2048:2051], []byte{1, 2, 3}) || data[3072] != 4 {
+		t.Errorf("data")
+	}
+
+	// the 10th same name
+	d = NewDisk(time.Time{})
+	for i := 0; i < 10; i++ {
+		if _, err := d.AddFile("A", "BIN", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := d.AddFile("A", "BIN", nil); err == nil {
+		t.Errorf("too many files: no error")
+	}
+	// before 1980
+	if e := d.Bytes()[7*SectorSize:]; binary.LittleEndian.Uint16(e[24:]) != 1<<5|1 {
+		t.Errorf("epoch: date %04x", binary.LittleEndian.Uint16(e[24:]))
+	}
+}
+
+func TestDiskData(t *testing.T) {
+	tests := []struct {
+		file *File
+		want []byte
+	}{
+		{&File{Data: []byte{1, 2}}, []byte{1, 2}},
+		{&File{Header: &Header{Type: TypeBASIC}, Data: []byte{0x07, 0x80}}, []byte{0xff, 0x07, 0x80}},
+		{&File{Header: &Header{Type: TypeASCII}, Data: []byte("10 END\r\n\x1a\x1a\x1a")}, []byte("10 END\r\n\x1a")},
+		{&File{Header: &Header{Type: TypeASCII}, Data: []byte("10 END\r\n")}, []byte("10 END\r\n\x1a")},
+		{&File{Header: &Header{Type: TypeBinary}, Data: []byte{0x00, 0xc0, 0x01, 0xc0, 0x00, 0xc0, 0xc9, 0x00, 0, 0}},
+			[]byte{0xfe, 0x00, 0xc0, 0x01, 0xc0, 0x00, 0xc0, 0xc9, 0x00}},
+	}
+	for i, tt := range tests {
+		got, err := tt.file.DiskData()
+		if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%d: got % x, want % x", i, got, tt.want)
+		}
+	}
+
+	if _, err := (&File{Header: &Header{Type: TypeBinary}, Data: []byte{0x00, 0xc0}}).DiskData(); err == nil {
+		t.Errorf("short binary: no error")
+	}
+}
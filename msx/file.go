@@ -0,0 +1,173 @@
+package msx
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// FileType is the type of the file on tape, by the ID in the header block.
+type FileType byte
+
+const (
+	TypeBASIC  FileType = 0xd3 // tokenized BASIC: CSAVE
+	TypeASCII  FileType = 0xea // ASCII text: SAVE "CAS:"
+	TypeBinary FileType = 0xd0 // machine code: BSAVE
+)
+
+// header block: 10 bytes of the ID + 6 bytes of the name
+const (
+	IDLen     = 10
+	NameLen   = 6
+	HeaderLen = IDLen + NameLen
+)
+
+func (t FileType) String() string {
+	switch t {
+	case TypeBASIC:
+		return "BASIC"
+	case TypeASCII:
+		return "ASCII"
+	case TypeBinary:
+		return "binary"
+	}
+	return fmt.Sprintf("unknown(%02x)", byte(t))
+}
+
+// Ext returns the extension of the file.
+func (t FileType) Ext() string {
+	switch t {
+	case TypeBASIC:
+		return ".bas"
+	case TypeASCII:
+		return ".asc"
+	}
+	return ".bin"
+}
+
+// Header is the header block of a file.
+type Header struct {
+	Type FileType
+	Name string // 6 chars, padded by spaces
+}
+
+// ParseHeader parses a header block.
+func ParseHeader(block []byte) (*Header, error) {
+	if len(block) < HeaderLen {
+		return nil, fmt.Errorf("invalid header length: %d", len(block))
+	}
+	t := FileType(block[0])
+	if t != TypeBASIC && t != TypeASCII && t != TypeBinary {
+		return nil, fmt.Errorf("invalid file type: %02x", block[0])
+	}
+	for _, id := range block[1:IDLen] {
+		if FileType(id) != t {
+			return nil, fmt.Errorf("invalid file ID: %02x", id)
+		}
+	}
+	return &Header{Type: t, Name: string(block[IDLen:HeaderLen])}, nil
+}
+
+// Bytes returns the header block.
+func (h *Header) Bytes() []byte {
+	b := make([]byte, HeaderLen)
+	for i := 0; i < IDLen; i++ {
+		b[i] = byte(h.Type)
+	}
+	name := h.Name + strings.Repeat(" ", NameLen)
+	copy(b[IDLen:], name[0:NameLen])
+	return b
+}
+
+// TapeName returns the name on tape of a file path: "01_NAME.bin" (extracted by MSX2bin) -> "NAME".
+func TapeName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	if len(name) > 3 && '0' <= name[0] && name[0] <= '9' && '0' <= name[1] && name[1] <= '9' && name[2] == '_' {
+		name = name[3:]
+	}
+	name = strings.ToUpper(name)
+	if len(name) > NameLen {
+		name = name[0:NameLen]
+	}
+	return name
+}
+
+// FileName returns a safe name for the file system: the name on tape without the padding.
+func FileName(name string) string {
+	ret := []byte(strings.TrimRight(name, " "))
+	for i, c := range ret {
+		if c < 0x20 || c >= 0x7f || strings.IndexByte(`/\:*?"<>|`, c) >= 0 {
+			ret[i] = '_'
+		}
+	}
+	if len(ret) == 0 {
+		return "noname"
+	}
+	return string(ret)
+}
+
+// File is a header and the data blocks.
+// Header is nil if the data block has no header.
+type File struct {
+	*Header
+	Data  []byte
+	Index int // index of the 1st block
+	Count int // number of the blocks
+}
+
+// Files pairs the header blocks with the following data blocks.
+// The data of ASCII files (SAVE "CAS:" and OPEN "CAS:") is the blocks until EOF (0x1A).
+func Files(blocks [][]byte) []*File {
+	var files []*File
+	for i := 0; i < len(blocks); i++ {
+		h, err := ParseHeader(blocks[i])
+		if err != nil {
+			// orphan data block
+			files = append(files, &File{Data: blocks[i], Index: i, Count: 1})
+			continue
+		}
+		f := &File{Header: h, Index: i, Count: 1}
+		for i+1 < len(blocks) {
+			if _, err := ParseHeader(blocks[i+1]); err == nil {
+				break
+			}
+			f.Data = append(f.Data, blocks[i+1]...)
+			f.Count++
+			i++
+			if h.Type != TypeASCII || bytes.IndexByte(blocks[i], ASCIIEOF) >= 0 {
+				break
+			}
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+// Text converts the data of an ASCII file to text until EOF.
+// CR LF is converted to LF, and the characters to unicode.
+func Text(data []byte) string {
+	if i := bytes.IndexByte(data, ASCIIEOF); i >= 0 {
+		data = data[0:i]
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == '\r':
+			if i+1 < len(data) && data[i+1] == '\n' {
+				continue
+			}
+			sb.WriteByte('\n')
+		case c == '\n' || c == '\t':
+			sb.WriteByte(c)
+		case c == 0x01 && i+1 < len(data):
+			i++
+			sb.WriteString(GraphicToString(data[i]))
+		default:
+			sb.WriteString(CharToString(c))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,96 @@
+package msx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTapeName(t *testing.T) {
+	tests := []struct{ path, want string }{
+		{"hello.bas", "HELLO"},
+		{"dir/01_game.bin", "GAME"},
+		{"1_abc.asc", "1_ABC"},
+		{"longname.bin", "LONGNA"},
+	}
+	for _, tt := range tests {
+		if got := TapeName(tt.path); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestFileName(t *testing.T) {
+	tests := []struct{ name, want string }{
+		{"HELLO ", "HELLO"},
+		{"A/B:C\xff", "A_B_C_"},
+		{"      ", "noname"},
+	}
+	for _, tt := range tests {
+		if got := FileName(tt.name); got != tt.want {
+			t.Errorf("%q: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFilesASCII(t *testing.T) {
+	// 600 bytes of text: 3 blocks of 256 bytes
+	var text []byte
+	for n := 10; len(text) < 600; n += 10 {
+		text = append(text, fmt.Sprintf("%d PRINT \"%d\"\r\n", n, n)...)
+	}
+	text = text[0:600]
+	asc := &File{Header: &Header{Type: TypeASCII, Name: "TEXT  "}, Data: text}
+	bin := &File{Header: &Header{Type: TypeBinary, Name: "PROG  "}, Data: []byte{0x00, 0xc0, 0x00, 0xc0, 0x00, 0xc0, 0xc9}}
+	var blocks [][]byte
+	blocks = append(blocks, asc.Blocks()...)
+	blocks = append(blocks, bin.Blocks()...)
+	blocks = append(blocks, []byte{0x12, 0x34}) // orphan
+	if len(blocks) != 1+3+2+1 {
+		t.Fatalf("%d blocks", len(blocks))
+	}
+	if b := blocks[3]; len(b) != ASCIIBlockLen || b[600-512] != ASCIIEOF || b[ASCIIBlockLen-1] != ASCIIEOF {
+		t.Fatalf("last ASCII block: % x", b)
+	}
+
+	files := Files(blocks)
+	if len(files) != 3 {
+		t.Fatalf("%d files", len(files))
+	}
+
+	f := files[0]
+	if f.Type != TypeASCII || f.Index != 0 || f.Count != 4 || len(f.Data) != 3*ASCIIBlockLen {
+		t.Errorf("ASCII: %v, index %d, count %d, length %d", f.Type, f.Index, f.Count, len(f.Data))
+	}
+	if !bytes.Equal(f.Data[0:600], text) || len(bytes.Trim(f.Data[600:], "\x1a")) != 0 {
+		t.Errorf("ASCII: data")
+	}
+	want := strings.ReplaceAll(string(text), "\r\n", "\n")
+	if got := Text(f.Data); got != want {
+		t.Errorf("ASCII: text %q", got)
+	}
+
+	f = files[1]
+	if f.Type != TypeBinary || f.Index != 4 || f.Count != 2 || !bytes.Equal(f.Data, bin.Data) {
+		t.Errorf("binary: %v, index %d, count %d, % x", f.Type, f.Index, f.Count, f.Data)
+	}
+	f = files[2]
+	if f.Header != nil || f.Index != 6 || !bytes.Equal(f.Data, []byte{0x12, 0x34}) {
+		t.Errorf("orphan: %+v", f)
+	}
+
+	// the next header ends an ASCII file without EOF
+	files = Files([][]byte{asc.Header.Bytes(), text[0:256], bin.Header.Bytes(), bin.Data})
+	if len(files) != 2 || files[0].Count != 2 || !bytes.Equal(files[0].Data, text[0:256]) || files[1].Type != TypeBinary || !bytes.Equal(files[1].Data, bin.Data) {
+		t.Errorf("no EOF: %d files", len(files))
+	}
+}
+
+func TestText(t *testing.T) {
+	data := []byte("10 PRINT\"\x01\x41\x86\"\r\n20 END\r\r\n\tX\n\x1a30 GARBAGE")
+	want := "10 PRINT\"" + GraphicToString(0x41) + CharToString(0x86) + "\"\n20 END\n\n\tX\n"
+	if got := Text(data); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package msx
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// tape format
+//
+//	silence
+//	long leader:  2400 Hz, 16000 cycles (about 6.7 sec)
+//	header block: 16 bytes
+//	short leader: 2400 Hz, 4000 cycles (about 1.7 sec)
+//	data block
+//	...
+//
+// Each block is followed by 11 ones (an idle byte) to terminate the last stop bit.
+// byte: start bit(0) + 8 bits from LSB + stop bits(1, 1)
+//
+//	1200 baud: Zero 1200 Hz x1, One 2400 Hz x2
+//	2400 baud: Zero 2400 Hz x1, One 4800 Hz x2
+const (
+	LongLeader  = 16000 // cycles at 1200 baud
+	ShortLeader = 4000  // cycles at 1200 baud
+
+	// Silence is a bit of no signal.
+	Silence = 2
+
+	// ones after the block, the last stop bit is terminated by them
+	trailerOnes = 11
+
+	// ASCII files are split into the blocks of 256 bytes, the last one is padded by EOF.
+	ASCIIBlockLen = 256
+	ASCIIEOF      = 0x1a
+)
+
+// ParseFileType parses "bas", "asc" or "bin".
+func ParseFileType(s string) (FileType, error) {
+	switch strings.ToLower(strings.TrimPrefix(s, ".")) {
+	case "bas", "basic":
+		return TypeBASIC, nil
+	case "asc", "ascii", "txt":
+		return TypeASCII, nil
+	case "bin", "binary", "rom":
+		return TypeBinary, nil
+	}
+	return 0, fmt.Errorf("unknown file type: %s", s)
+}
+
+// AppendByte appends the bits of a byte.
+func AppendByte(dst []byte, b byte) []byte {
+	dst = append(dst, 0)
+	for i := 0; i < 8; i++ {
+		dst = append(dst, (b>>i)&1)
+	}
+	return append(dst, 1, 1)
+}
+
+// BlockBits returns the bits of a block with the leader.
+// The long leader is for the header blocks, it's preceded by 1 sec of silence.
+func BlockBits(block []byte, long bool, baud int) []byte {
+	cycles := ShortLeader
+	if long {
+		cycles = LongLeader
+	}
+	// a One is 2 cycles, the duration of the leader is the same for any baud rate
+	ones := cycles / 2 * baud / 1200
+
+	bits := make([]byte, 0, baud+ones+len(block)*11+trailerOnes)
+	if long {
+		for i := 0; i < baud; i++ {
+			bits = append(bits, Silence)
+		}
+	}
+	for i := 0; i < ones; i++ {
+		bits = append(bits, 1)
+	}
+	for _, b := range block {
+		bits = AppendByte(bits, b)
+	}
+	for i := 0; i < trailerOnes; i++ {
+		bits = append(bits, 1)
+	}
+	return bits
+}
+
+// TapeBits returns the bits of the blocks.
+// The header blocks are detected by the ID.
+func TapeBits(blocks [][]byte, baud int) []byte {
+	var bits []byte
+	for _, b := range blocks {
+		_, err := ParseHeader(b)
+		bits = append(bits, BlockBits(b, err == nil, baud)...)
+	}
+	// 1 sec of silence at the end
+	for i := 0; i < baud; i++ {
+		bits = append(bits, Silence)
+	}
+	return bits
+}
+
+// Blocks returns the header block and the data blocks of the file.
+// A header without data (Data is nil) has no data block.
+func (f *File) Blocks() [][]byte {
+	var blocks [][]byte
+	if f.Header != nil {
+		blocks = append(blocks, f.Header.Bytes())
+	}
+	if f.Data == nil {
+		return blocks
+	}
+	if f.Header == nil || f.Type != TypeASCII {
+		return append(blocks, f.Data)
+	}
+
+	// ASCII: blocks of 256 bytes until EOF
+	data := f.Data
+	if i := bytes.IndexByte(data, ASCIIEOF); i >= 0 {
+		data = data[0:i]
+	}
+	for {
+		block := make([]byte, ASCIIBlockLen)
+		n := copy(block, data)
+		data = data[n:]
+		for i := n; i < ASCIIBlockLen; i++ {
+			block[i] = ASCIIEOF
+		}
+		blocks = append(blocks, block)
+		if n < ASCIIBlockLen {
+			return blocks
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package msx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// BASICStart is the address of the 1st line of BASIC programs: TXTTAB.
+const BASICStart = 0x8001
+
+// CSAVE writes 7 zeros after the end mark, CLOAD stops at 10 zeros: EOL + end mark + 7 zeros.
+const basicTailLen = 7
+
+// keyword is a statement, an operator or a function and its codes.
+type keyword struct {
+	text  string
+	codes []byte
+}
+
+// keywords sorted by length (longest match first)
+var keywords = func() []keyword {
+	var kws []keyword
+	for i, t := range tokens {
+		code := byte(tokenFirst + i)
+		if code == tokenQuoteREM {
+			// ' is converted to :REM'
+			continue
+		}
+		kws = append(kws, keyword{t, []byte{code}})
+	}
+	for i, t := range functions {
+		kws = append(kws, keyword{t, []byte{codeFunction, byte(functionFirst + i)}})
+	}
+	sort.SliceStable(kws, func(i, j int) bool {
+		return len(kws[i].text) > len(kws[j].text)
+	})
+	return kws
+}()
+
+// keywords which take line numbers
+var lineNumTokens = tokenSet("GOTO", "GOSUB", "THEN", "ELSE", "RUN", "RESTORE", "RETURN", "RESUME", "LIST", "LLIST", "DELETE", "RENUM", "AUTO")
+
+// keywords which take ranges of line numbers: LIST 10-20
+var lineRangeTokens = tokenSet("LIST", "LLIST", "DELETE")
+
+func tokenSet(names ...string) map[byte]bool {
+	m := make(map[byte]bool)
+	for _, t := range names {
+		for i := range tokens {
+			if tokens[i] == t {
+				m[byte(tokenFirst+i)] = true
+			}
+		}
+	}
+	return m
+}
+
+// TokenizeLine converts a text line "10 PRINT ..." to a Line.
+func TokenizeLine(text string) (Line, error) {
+	text = strings.TrimLeft(text, " ")
+	i := 0
+	for i < len(text) && '0' <= text[i] && text[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return Line{}, fmt.Errorf("no line number: %q", text)
+	}
+	num, err := strconv.ParseUint(text[0:i], 10, 16)
+	if err != nil || num > 65529 {
+		return Line{}, fmt.Errorf("invalid line number: %s", text[0:i])
+	}
+	// a space after the line number is just a separator
+	text = strings.TrimPrefix(text[i:], " ")
+
+	body, err := Tokenize(text)
+	if err != nil {
+		return Line{}, fmt.Errorf("line %d: %w", num, err)
+	}
+	return Line{Number: uint16(num), Body: body}, nil
+}
+
+// Tokenize converts the body of a line to intermediate codes.
+// It's the reverse of Detokenize.
+func Tokenize(text string) ([]byte, error) {
+	ret := make([]byte, 0, len(text))
+
+	lineNum := false   // after GOTO etc.
+	lineRange := false // after LIST etc.
+	ident := false     // in a variable name: the digits are not numbers
+	for len(text) > 0 {
+		c := text[0]
+
+		// string
+		if c == '"' {
+			end := strings.IndexByte(text[1:], '"')
+			if end < 0 {
+				end = len(text)
+			} else {
+				end += 2
+			}
+			chars, err := StringToChars(text[:end])
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, chars...)
+			text = text[end:]
+			lineNum, lineRange, ident = false, false, false
+			continue
+		}
+
+		// ' = :REM'
+		if c == '\'' {
+			chars, err := StringToChars(text[1:])
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, codeColon, tokenREM, tokenQuoteREM)
+			return append(ret, chars...), nil
+		}
+
+		// &H, &O
+		if len(text) >= 2 && c == '&' && strings.IndexByte("HhOo", text[1]) >= 0 {
+			base, digits, code := 16, "0123456789ABCDEFabcdef", byte(codeHex)
+			if text[1] == 'O' || text[1] == 'o' {
+				base, digits, code = 8, "01234567", codeOct
+			}
+			i := 2
+			for i < len(text) && strings.IndexByte(digits, text[i]) >= 0 {
+				i++
+			}
+			v := uint64(0)
+			if i > 2 {
+				var err error
+				v, err = strconv.ParseUint(text[2:i], base, 16)
+				if err != nil {
+					return nil, fmt.Errorf("overflow: %s", text[0:i])
+				}
+			}
+			ret = append(ret, code, byte(v), byte(v>>8))
+			text = text[i:]
+			lineNum, lineRange, ident = false, false, false
+			continue
+		}
+
+		// numbers
+		if !ident && ('0' <= c && c <= '9' || c == '.' && len(text) > 1 && '0' <= text[1] && text[1] <= '9') {
+			codes, n, err := tokenizeNumber(text, lineNum)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, codes...)
+			text = text[n:]
+			ident = false
+			continue
+		}
+
+		// keywords
+		if c == '?' {
+			// PRINT
+			text = "PRINT" + text[1:]
+		}
+		if kw, ok := matchKeyword(text); ok {
+			code := kw.codes[len(kw.codes)-1]
+			if len(kw.codes) == 1 && code == tokenELSE {
+				// ELSE is saved as :ELSE
+				ret = append(ret, codeColon)
+			}
+			ret = append(ret, kw.codes...)
+			text = text[len(kw.text):]
+			ident = false
+			if len(kw.codes) == 1 && code == tokenMinus && lineNum && lineRange {
+				// LIST 10-20
+				continue
+			}
+			lineNum = len(kw.codes) == 1 && lineNumTokens[code]
+			lineRange = len(kw.codes) == 1 && lineRangeTokens[code]
+
+			if len(kw.codes) > 1 {
+				continue
+			}
+			switch code {
+			case tokenREM:
+				// comment
+				chars, err := StringToChars(text)
+				if err != nil {
+					return nil, err
+				}
+				return append(ret, chars...), nil
+			case tokenDATA:
+				// raw characters until ':'
+				end := dataEnd(text)
+				chars, err := StringToChars(text[:end])
+				if err != nil {
+					return nil, err
+				}
+				ret = append(ret, chars...)
+				text = text[end:]
+			}
+			continue
+		}
+
+		// others
+		if c >= 0x80 {
+			return nil, errors.New("non-ASCII character outside of string")
+		}
+		if 'a' <= c && c <= 'z' {
+			c -= 'a' - 'A'
+		}
+		ret = append(ret, c)
+		text = text[1:]
+		if c != ' ' && c != ',' {
+			lineNum, lineRange = false, false
+		}
+		if c != ' ' {
+			ident = 'A' <= c && c <= 'Z' || ident && '0' <= c && c <= '9'
+		}
+	}
+
+	return ret, nil
+}
+
+func matchKeyword(text string) (keyword, bool) {
+	for _, kw := range keywords {
+		if len(text) >= len(kw.text) && strings.EqualFold(text[:len(kw.text)], kw.text) {
+			return kw, true
+		}
+	}
+	return keyword{}, false
+}
+
+func dataEnd(text string) int {
+	inString := false
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '"':
+			inString = !inString
+		case ':':
+			if !inString {
+				return i
+			}
+		}
+	}
+	return len(text)
+}
+
+// tokenizeNumber converts a number at the top of the text.
+// It returns the codes and the length of the text.
+//
+//	line number:          0x0E + 2 bytes
+//	integer 0 - 32767:    0x11 - 0x1A, 0x0F + 1 byte, 0x1C + 2 bytes
+//	single (!, E):        0x1D + 4 bytes BCD
+//	double (#, D, other): 0x1F + 8 bytes BCD
+func tokenizeNumber(text string, lineNum bool) ([]byte, int, error) {
+	isDigit := func(i int) bool {
+		return i < len(text) && '0' <= text[i] && text[i] <= '9'
+	}
+
+	// mantissa
+	i := 0
+	for isDigit(i) {
+		i++
+	}
+	intPart := text[0:i]
+	fracPart := ""
+	if i < len(text) && text[i] == '.' {
+		j := i + 1
+		for isDigit(j) {
+			j++
+		}
+		fracPart = text[i+1 : j]
+		i = j
+	}
+	isInt := len(intPart) == len(text[0:i])
+
+	// exponent: E+nn, D-nn
+	exp := 0
+	expChar := byte(0)
+	if i < len(text) && strings.IndexByte("EeDd", text[i]) >= 0 {
+		j := i + 1
+		if j < len(text) && (text[j] == '+' || text[j] == '-') {
+			j++
+		}
+		if isDigit(j) {
+			k := j
+			for isDigit(k) {
+				k++
+			}
+			e, err := strconv.Atoi(text[i+1 : k])
+			if err != nil {
+				return nil, 0, fmt.Errorf("overflow: %s", text[0:k])
+			}
+			exp = e
+			expChar = text[i] &^ 0x20
+			isInt = false
+			i = k
+		}
+	}
+
+	// type suffix
+	suffix := byte(0)
+	if i < len(text) && strings.IndexByte("%!#", text[i]) >= 0 {
+		suffix = text[i]
+		i++
+	}
+
+	if isInt && (suffix == 0 || suffix == '%') {
+		v, err := strconv.ParseUint(intPart, 10, 16)
+		switch {
+		case lineNum && suffix == 0 && err == nil:
+			return []byte{codeLineNum, byte(v), byte(v >> 8)}, i, nil
+		case err == nil && v <= 9:
+			return []byte{codeInt0 + byte(v)}, i, nil
+		case err == nil && v <= 0xff:
+			return []byte{codeInt8, byte(v)}, i, nil
+		case err == nil && v <= 32767:
+			return []byte{codeInt16, byte(v), byte(v >> 8)}, i, nil
+		case suffix == '%':
+			return nil, 0, fmt.Errorf("overflow: %s", text[0:i])
+		}
+	}
+
+	if suffix == '%' {
+		return nil, 0, fmt.Errorf("type mismatch: %s", text[0:i])
+	}
+	double := true
+	if suffix == '!' || expChar == 'E' {
+		double = false
+	}
+	if suffix == '#' || expChar == 'D' {
+		double = true
+	}
+	b, err := parseBCD(intPart+fracPart, len(intPart)+exp, double)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%w: %s", err, text[0:i])
+	}
+	if double {
+		return append([]byte{codeDouble}, b...), i, nil
+	}
+	return append([]byte{codeSingle}, b...), i, nil
+}
+
+// parseBCD converts the digits to BCD: 0.digits x 10^point.
+// It's the reverse of formatBCD.
+func parseBCD(digits string, point int, double bool) ([]byte, error) {
+	n := 6
+	if double {
+		n = 14
+	}
+	ret := make([]byte, 1+n/2)
+
+	// normalize
+	for len(digits) > 0 && digits[0] == '0' {
+		digits = digits[1:]
+		point--
+	}
+	if digits == "" {
+		return ret, nil
+	}
+
+	// round
+	d := []byte(digits)
+	if len(d) > n {
+		up := d[n] >= '5'
+		d = d[0:n]
+		for i := n - 1; up && i >= 0; i-- {
+			d[i]++
+			up = d[i] > '9'
+			if up {
+				d[i] = '0'
+			}
+		}
+		if up {
+			d = append([]byte{'1'}, d[0:n-1]...)
+			point++
+		}
+	}
+	for len(d) < n {
+		d = append(d, '0')
+	}
+
+	e := 0x40 + point
+	if e < 0x01 {
+		// underflow
+		return make([]byte, len(ret)), nil
+	}
+	if e > 0x7f {
+		return nil, errors.New("overflow")
+	}
+	ret[0] = byte(e)
+	for i := 0; i < n; i += 2 {
+		ret[1+i/2] = (d[i]-'0')<<4 | (d[i+1] - '0')
+	}
+	return ret, nil
+}
+
+// Program encodes lines to tokenized BASIC code (CSAVE) at addr.
+// The link pointers are the addresses of the next lines, the code ends with 0x0000 and 7 zeros.
+func Program(lines []Line, addr uint16) ([]byte, error) {
+	ret := make([]byte, 0, 4096)
+	for _, l := range lines {
+		next := int(addr) + len(ret) + 2 + 2 + len(l.Body) + 1
+		if next > 0xffff {
+			return nil, fmt.Errorf("line %d: out of memory", l.Number)
+		}
+		if len(l.Body) > 0xff {
+			return nil, fmt.Errorf("line %d: too long: %d", l.Number, len(l.Body))
+		}
+		ret = append(ret, byte(next), byte(next>>8), byte(l.Number), byte(l.Number>>8))
+		ret = append(ret, l.Body...)
+		ret = append(ret, codeEOL)
+	}
+	// end mark
+	ret = append(ret, 0x00, 0x00)
+	return append(ret, make([]byte, basicTailLen)...), nil
+}
@@ -0,0 +1,152 @@
+package msx
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []byte
+		list string // Detokenize, "" for text
+	}{
+		// spaces in strings, REM and DATA are 0x20
+		{`PRINT "HELLO WORLD"`, []byte{0x91, ' ', '"', 'H', 'E', 'L', 'L', 'O', ' ', 'W', 'O', 'R', 'L', 'D', '"'}, ""},
+		{`REM HI THERE`, []byte{0x8f, ' ', 'H', 'I', ' ', 'T', 'H', 'E', 'R', 'E'}, ""},
+		{`DATA A B:END`, []byte{0x84, ' ', 'A', ' ', 'B', ':', 0x81}, ""},
+		{`' HI`, []byte{':', 0x8f, 0xe6, ' ', 'H', 'I'}, ""},
+		{`?A`, []byte{0x91, 'A'}, "PRINTA"},
+
+		// line numbers
+		{`GOTO 100`, []byte{0x89, ' ', 0x0e, 100, 0}, ""},
+		{`ON X GOTO 10,20`, []byte{0x95, ' ', 'X', ' ', 0x89, ' ', 0x0e, 10, 0, ',', 0x0e, 20, 0}, ""},
+		{`IF A THEN 10 ELSE 20`, []byte{0x8b, ' ', 'A', ' ', 0xda, ' ', 0x0e, 10, 0, ' ', ':', 0xa1, ' ', 0x0e, 20, 0}, ""},
+		{`LIST 10-20`, []byte{0x93, ' ', 0x0e, 10, 0, 0xf2, 0x0e, 20, 0}, ""},
+		{`DELETE 10-20`, []byte{0xa8, ' ', 0x0e, 10, 0, 0xf2, 0x0e, 20, 0}, ""},
+		{`GOTO 10-20`, []byte{0x89, ' ', 0x0e, 10, 0, 0xf2, 0x0f, 20}, ""},
+		{`A=B-20`, []byte{'A', 0xef, 'B', 0xf2, 0x0f, 20}, ""},
+
+		// numbers
+		{`A=5`, []byte{'A', 0xef, 0x16}, ""},
+		{`A=255`, []byte{'A', 0xef, 0x0f, 0xff}, ""},
+		{`A=256`, []byte{'A', 0xef, 0x1c, 0x00, 0x01}, ""},
+		{`A=300%`, []byte{'A', 0xef, 0x1c, 0x2c, 0x01}, "A=300"},
+		{`A=32768`, []byte{'A', 0xef, 0x1f, 0x45, 0x32, 0x76, 0x80, 0, 0, 0, 0}, ""},
+		{`A=1.5`, []byte{'A', 0xef, 0x1f, 0x41, 0x15, 0, 0, 0, 0, 0, 0}, ""},
+		{`A=1.5!`, []byte{'A', 0xef, 0x1d, 0x41, 0x15, 0, 0}, ""},
+		{`A=.5`, []byte{'A', 0xef, 0x1f, 0x40, 0x50, 0, 0, 0, 0, 0, 0}, ""},
+		{`A=1E10`, []byte{'A', 0xef, 0x1d, 0x4b, 0x10, 0, 0}, "A=1E+10"},
+		{`A=1.25D-20`, []byte{'A', 0xef, 0x1f, 0x2d, 0x12, 0x50, 0, 0, 0, 0, 0}, "A=1.25D-20"},
+		{`A=&HFF`, []byte{'A', 0xef, 0x0c, 0xff, 0x00}, ""},
+		{`A=&O17`, []byte{'A', 0xef, 0x0b, 0x0f, 0x00}, ""},
+
+		// names and functions
+		{`X1=A1`, []byte{'X', '1', 0xef, 'A', '1'}, ""},
+		{`a$=left$(b$,1)`, []byte{'A', '$', 0xef, 0xff, 0x81, '(', 'B', '$', ',', 0x12, ')'}, "A$=LEFT$(B$,1)"},
+		{`FOR I=1 TO 10`, []byte{0x82, ' ', 'I', 0xef, 0x12, ' ', 0xd9, ' ', 0x0f, 10}, ""},
+	}
+	for _, tt := range tests {
+		got, err := Tokenize(tt.text)
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%q: got % x, want % x", tt.text, got, tt.want)
+			continue
+		}
+
+		list, err := Detokenize(got)
+		if err != nil {
+			t.Errorf("%q: %v", tt.text, err)
+			continue
+		}
+		want := tt.list
+		if want == "" {
+			want = tt.text
+		}
+		if list != want {
+			t.Errorf("%q: list %q, want %q", tt.text, list, want)
+		}
+	}
+}
+
+func TestTokenizeError(t *testing.T) {
+	for _, text := range []string{`A=40000%`, `A=1.5%`, `A=1E200`, `A=&H10000`} {
+		if _, err := Tokenize(text); err == nil {
+			t.Errorf("%q: no error", text)
+		}
+	}
+}
+
+func TestParseBCD(t *testing.T) {
+	tests := []struct {
+		digits string
+		point  int
+		double bool
+		want   []byte
+	}{
+		{"15", 1, false, []byte{0x41, 0x15, 0x00, 0x00}},
+		{"0015", 1, false, []byte{0x3f, 0x15, 0x00, 0x00}},
+		{"000", 3, true, []byte{0, 0, 0, 0, 0, 0, 0, 0}},
+		{"1234567", 7, false, []byte{0x47, 0x12, 0x34, 0x57}},
+		{"9999995", 7, false, []byte{0x48, 0x10, 0x00, 0x00}},
+		{"12345678901234567", 17, true, []byte{0x51, 0x12, 0x34, 0x56, 0x78, 0x90, 0x12, 0x35}},
+	}
+	for _, tt := range tests {
+		got, err := parseBCD(tt.digits, tt.point, tt.double)
+		if err != nil {
+			t.Errorf("%s, %d: %v", tt.digits, tt.point, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("%s, %d: got % x, want % x", tt.digits, tt.point, got, tt.want)
+		}
+	}
+
+	if _, err := parseBCD("1", 0x40, false); err == nil {
+		t.Errorf("overflow: no error")
+	}
+}
+
+func TestProgram(t *testing.T) {
+	lines := []Line{
+		{Number: 10, Body: []byte{0x91}},
+		{Number: 20, Body: []byte{0x81}},
+	}
+	got, err := Program(lines, BASICStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0x07, 0x80, 10, 0, 0x91, 0,
+		0x0d, 0x80, 20, 0, 0x81, 0,
+		0, 0, // end mark
+		0, 0, 0, 0, 0, 0, 0,
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got % x, want % x", got, want)
+	}
+
+	parsed, err := ParseProgram(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(lines) {
+		t.Fatalf("%d lines, want %d", len(parsed), len(lines))
+	}
+	for i, l := range parsed {
+		if l.Number != lines[i].Number || !bytes.Equal(l.Body, lines[i].Body) {
+			t.Errorf("line %d: got %d % x", i, l.Number, l.Body)
+		}
+	}
+
+	list, err := List(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list != "10 PRINT\n20 END\n" {
+		t.Errorf("list %q", list)
+	}
+}
@@ -0,0 +1,108 @@
+package msx
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// TSX: TZX based tape image for MSX
+//
+// Each block is saved as ID 0x4B "Kansas City Standard" block.
+// The timings are in T-states of ZX Spectrum (3.5 MHz).
+const (
+	TSXClock = 3500000
+
+	TSXBlockKCS = 0x4b
+)
+
+// TSXSignature is the file header: "ZXTape!", 0x1A, version 1.21
+var TSXSignature = []byte{'Z', 'X', 'T', 'a', 'p', 'e', '!', 0x1a, 1, 21}
+
+// KCS block
+//
+//	length:      4 bytes, from pause to the end of data
+//	pause:       2 bytes, after the block [ms]
+//	pilot:       2 bytes, length of a pulse [T-states]
+//	pilotPulses: 2 bytes
+//	zero:        2 bytes, length of a pulse [T-states]
+//	one:         2 bytes, length of a pulse [T-states]
+//	bitConfig:   1 byte, pulses of Zero (bit 7-4) and One (bit 3-0)
+//	byteConfig:  1 byte, leading bits (bit 7-6), the value (bit 5),
+//	             trailing bits (bit 4-3), the value (bit 2), MSB first (bit 0)
+//	data:        N bytes
+type tsxKCS struct {
+	Length      uint32
+	Pause       uint16
+	Pilot       uint16
+	PilotPulses uint16
+	Zero        uint16
+	One         uint16
+	BitConfig   byte
+	ByteConfig  byte
+}
+
+const (
+	tsxKCSHeaderLen = 12 // from pause to byteConfig
+
+	// MSX: Zero 2 pulses, One 4 pulses
+	tsxBitConfig = 0x24
+	// MSX: 1 start bit(0), 2 stop bits(1), LSB first
+	tsxByteConfig = 0x54
+
+	// pause after the data blocks [ms]
+	tsxPause = 1000
+)
+
+// WriteTSX writes the blocks as a TSX file at the baud rates of each block.
+// The header blocks have the long leader.
+func WriteTSX(w io.Writer, blocks [][]byte, bauds []int) error {
+	_, err := w.Write(TSXSignature)
+	if err != nil {
+		return err
+	}
+
+	for i, b := range blocks {
+		baud := bauds[i]
+		// a One pulse is a half cycle of 2*baud Hz
+		one := uint16((TSXClock + baud*2) / (baud * 4))
+
+		_, err := ParseHeader(b)
+		isHeader := err == nil
+		cycles := ShortLeader
+		if isHeader {
+			cycles = LongLeader
+		}
+
+		// pause before the next header
+		pause := uint16(0)
+		if i+1 == len(blocks) {
+			pause = tsxPause
+		} else if _, err := ParseHeader(blocks[i+1]); err == nil {
+			pause = tsxPause
+		}
+
+		h := tsxKCS{
+			Length:      uint32(tsxKCSHeaderLen + len(b)),
+			Pause:       pause,
+			Pilot:       one,
+			PilotPulses: uint16(cycles * 2 * baud / 1200),
+			Zero:        one * 2,
+			One:         one,
+			BitConfig:   tsxBitConfig,
+			ByteConfig:  tsxByteConfig,
+		}
+		_, err = w.Write([]byte{TSXBlockKCS})
+		if err != nil {
+			return err
+		}
+		err = binary.Write(w, binary.LittleEndian, &h)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
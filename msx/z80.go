@@ -0,0 +1,438 @@
+package msx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Z80 disassembler
+//
+// The opcodes are decoded by the fields: x(bit 7-6), y(bit 5-3), z(bit 2-0), p(bit 5-4), q(bit 3).
+// The prefixes DD and FD replace HL by IX and IY.
+var (
+	z80r    = [8]string{"B", "C", "D", "E", "H", "L", "(HL)", "A"}
+	z80rp   = [4]string{"BC", "DE", "HL", "SP"}
+	z80rp2  = [4]string{"BC", "DE", "HL", "AF"}
+	z80cc   = [8]string{"NZ", "Z", "NC", "C", "PO", "PE", "P", "M"}
+	z80alu  = [8]string{"ADD A,", "ADC A,", "SUB ", "SBC A,", "AND ", "XOR ", "OR ", "CP "}
+	z80rot  = [8]string{"RLC", "RRC", "RL", "RR", "SLA", "SRA", "SLL", "SRL"}
+	z80x0z7 = [8]string{"RLCA", "RRCA", "RLA", "RRA", "DAA", "CPL", "SCF", "CCF"}
+	z80ed7  = [8]string{"LD I,A", "LD R,A", "LD A,I", "LD A,R", "RRD", "RLD", "NOP", "NOP"}
+	z80im   = [8]string{"0", "0", "1", "2", "0", "0", "1", "2"}
+	z80bli  = [4][4]string{
+		{"LDI", "CPI", "INI", "OUTI"},
+		{"LDD", "CPD", "IND", "OUTD"},
+		{"LDIR", "CPIR", "INIR", "OTIR"},
+		{"LDDR", "CPDR", "INDR", "OTDR"},
+	}
+)
+
+// Instruction is a disassembled instruction.
+type Instruction struct {
+	Addr   uint16
+	Bytes  []byte
+	Text   string
+	Target int // address of JP, JR, CALL, DJNZ and RST, -1 for others
+}
+
+// z80 is the state of decoding an instruction.
+type z80 struct {
+	code    []byte
+	addr    uint16
+	pos     int
+	index   string // "HL", "IX" or "IY"
+	disp    int    // displacement of (IX+d)
+	hasDisp bool   // the displacement is read only once
+	label   func(addr uint16) string
+
+	target int
+	short  bool // the code ends in the middle of the instruction
+}
+
+func (d *z80) next() byte {
+	if d.pos >= len(d.code) {
+		d.short = true
+		d.pos++
+		return 0
+	}
+	b := d.code[d.pos]
+	d.pos++
+	return b
+}
+
+func hex8(v byte) string {
+	s := fmt.Sprintf("%02XH", v)
+	if s[0] >= 'A' {
+		s = "0" + s
+	}
+	return s
+}
+
+func hex16(v uint16) string {
+	s := fmt.Sprintf("%04XH", v)
+	if s[0] >= 'A' {
+		s = "0" + s
+	}
+	return s
+}
+
+func (d *z80) n() string {
+	return hex8(d.next())
+}
+
+func (d *z80) nn() uint16 {
+	lo := d.next()
+	hi := d.next()
+	return uint16(lo) | uint16(hi)<<8
+}
+
+// address operand with the label
+func (d *z80) addrString(a uint16) string {
+	if d.label != nil {
+		if l := d.label(a); l != "" {
+			return l
+		}
+	}
+	return hex16(a)
+}
+
+func (d *z80) jump(a uint16) string {
+	d.target = int(a)
+	return d.addrString(a)
+}
+
+func (d *z80) rel() string {
+	e := int8(d.next())
+	return d.jump(d.addr + uint16(d.pos) + uint16(e))
+}
+
+// (HL) or (IX+d)
+func (d *z80) mem() string {
+	if d.index == "HL" {
+		return "(HL)"
+	}
+	if !d.hasDisp {
+		d.disp = int(int8(d.next()))
+		d.hasDisp = true
+	}
+	if d.disp < 0 {
+		return fmt.Sprintf("(%s-%s)", d.index, hex8(byte(-d.disp)))
+	}
+	return fmt.Sprintf("(%s+%s)", d.index, hex8(byte(d.disp)))
+}
+
+// register r[i], H and L are replaced by IXH and IXL unless (IX+d) is in the same instruction.
+func (d *z80) r(i byte, withMem bool) string {
+	switch {
+	case i == 6:
+		return d.mem()
+	case (i == 4 || i == 5) && d.index != "HL" && !withMem:
+		return d.index + z80r[i][0:1]
+	}
+	return z80r[i]
+}
+
+func (d *z80) rp(p byte) string {
+	if p == 2 {
+		return d.index
+	}
+	return z80rp[p]
+}
+
+func (d *z80) rp2(p byte) string {
+	if p == 2 {
+		return d.index
+	}
+	return z80rp2[p]
+}
+
+// main opcodes, with or without DD/FD
+func (d *z80) decode(op byte) string {
+	x, y, z := op>>6, (op>>3)&7, op&7
+	p, q := y>>1, y&1
+
+	switch x {
+	case 0:
+		switch z {
+		case 0:
+			switch y {
+			case 0:
+				return "NOP"
+			case 1:
+				return "EX AF,AF'"
+			case 2:
+				return "DJNZ " + d.rel()
+			case 3:
+				return "JR " + d.rel()
+			}
+			return "JR " + z80cc[y-4] + "," + d.rel()
+		case 1:
+			if q == 0 {
+				return "LD " + d.rp(p) + "," + hex16(d.nn())
+			}
+			return "ADD " + d.index + "," + d.rp(p)
+		case 2:
+			switch y {
+			case 0:
+				return "LD (BC),A"
+			case 1:
+				return "LD A,(BC)"
+			case 2:
+				return "LD (DE),A"
+			case 3:
+				return "LD A,(DE)"
+			case 4:
+				return "LD (" + d.addrString(d.nn()) + ")," + d.index
+			case 5:
+				return "LD " + d.index + ",(" + d.addrString(d.nn()) + ")"
+			case 6:
+				return "LD (" + d.addrString(d.nn()) + "),A"
+			}
+			return "LD A,(" + d.addrString(d.nn()) + ")"
+		case 3:
+			if q == 0 {
+				return "INC " + d.rp(p)
+			}
+			return "DEC " + d.rp(p)
+		case 4:
+			return "INC " + d.r(y, false)
+		case 5:
+			return "DEC " + d.r(y, false)
+		case 6:
+			r := d.r(y, false)
+			return "LD " + r + "," + d.n()
+		}
+		return z80x0z7[y]
+	case 1:
+		if y == 6 && z == 6 {
+			return "HALT"
+		}
+		withMem := y == 6 || z == 6
+		dst := d.r(y, withMem)
+		return "LD " + dst + "," + d.r(z, withMem)
+	case 2:
+		return z80alu[y] + d.r(z, false)
+	}
+
+	switch z {
+	case 0:
+		return "RET " + z80cc[y]
+	case 1:
+		if q == 0 {
+			return "POP " + d.rp2(p)
+		}
+		switch p {
+		case 0:
+			return "RET"
+		case 1:
+			return "EXX"
+		case 2:
+			return "JP (" + d.index + ")"
+		}
+		return "LD SP," + d.index
+	case 2:
+		return "JP " + z80cc[y] + "," + d.jump(d.nn())
+	case 3:
+		switch y {
+		case 0:
+			return "JP " + d.jump(d.nn())
+		case 1:
+			return d.decodeCB()
+		case 2:
+			return "OUT (" + d.n() + "),A"
+		case 3:
+			return "IN A,(" + d.n() + ")"
+		case 4:
+			return "EX (SP)," + d.index
+		case 5:
+			return "EX DE,HL"
+		case 6:
+			return "DI"
+		}
+		return "EI"
+	case 4:
+		return "CALL " + z80cc[y] + "," + d.jump(d.nn())
+	case 5:
+		if q == 0 {
+			return "PUSH " + d.rp2(p)
+		}
+		if p == 0 {
+			return "CALL " + d.jump(d.nn())
+		}
+		// DD, ED and FD are handled by the caller
+		return ""
+	case 6:
+		return z80alu[y] + d.n()
+	}
+	return "RST " + d.jump(uint16(y)*8)
+}
+
+// CB prefix: DD CB d op for IX
+func (d *z80) decodeCB() string {
+	var m string
+	if d.index != "HL" {
+		m = d.mem()
+	}
+	op := d.next()
+	x, y, z := op>>6, (op>>3)&7, op&7
+	r := m
+	if d.index == "HL" {
+		r = z80r[z]
+	}
+	switch x {
+	case 0:
+		return z80rot[y] + " " + r
+	case 1:
+		return fmt.Sprintf("BIT %d,%s", y, r)
+	case 2:
+		return fmt.Sprintf("RES %d,%s", y, r)
+	}
+	return fmt.Sprintf("SET %d,%s", y, r)
+}
+
+// ED prefix
+func (d *z80) decodeED() string {
+	op := d.next()
+	x, y, z := op>>6, (op>>3)&7, op&7
+	p, q := y>>1, y&1
+
+	if x == 1 {
+		switch z {
+		case 0:
+			if y == 6 {
+				return "IN (C)"
+			}
+			return "IN " + z80r[y] + ",(C)"
+		case 1:
+			if y == 6 {
+				return "OUT (C),0"
+			}
+			return "OUT (C)," + z80r[y]
+		case 2:
+			if q == 0 {
+				return "SBC HL," + z80rp[p]
+			}
+			return "ADC HL," + z80rp[p]
+		case 3:
+			if q == 0 {
+				return "LD (" + d.addrString(d.nn()) + ")," + z80rp[p]
+			}
+			return "LD " + z80rp[p] + ",(" + d.addrString(d.nn()) + ")"
+		case 4:
+			return "NEG"
+		case 5:
+			if y == 1 {
+				return "RETI"
+			}
+			return "RETN"
+		case 6:
+			return "IM " + z80im[y]
+		}
+		return z80ed7[y]
+	}
+	if x == 2 && z <= 3 && y >= 4 {
+		return z80bli[y-4][z]
+	}
+	return "DB 0EDH," + hex8(op)
+}
+
+// DisassembleOne decodes an instruction at the top of the code.
+// label returns the name of the address, or "".
+func DisassembleOne(code []byte, addr uint16, label func(uint16) string) Instruction {
+	d := &z80{code: code, addr: addr, index: "HL", label: label, target: -1}
+
+	op := d.next()
+	var text string
+	switch op {
+	case 0xdd, 0xfd:
+		if op == 0xdd {
+			d.index = "IX"
+		} else {
+			d.index = "IY"
+		}
+		op2 := d.next()
+		if op2 == 0xdd || op2 == 0xed || op2 == 0xfd || d.short {
+			// the prefix is ignored
+			d.pos = 1
+			d.short = false
+			text = "DB " + hex8(op)
+			break
+		}
+		if op2 == 0xcb {
+			text = d.decodeCB()
+			break
+		}
+		text = d.decode(op2)
+	case 0xcb:
+		text = d.decodeCB()
+	case 0xed:
+		text = d.decodeED()
+	default:
+		text = d.decode(op)
+	}
+
+	if d.short {
+		// data at the end of the code
+		d.pos = 1
+		text = "DB " + hex8(op)
+		d.target = -1
+	}
+	return Instruction{
+		Addr:   addr,
+		Bytes:  code[0:d.pos],
+		Text:   text,
+		Target: d.target,
+	}
+}
+
+// Disassemble converts the machine code at addr to a listing.
+// The jump targets in the code are labeled "Lxxxx", the BIOS entries by the names.
+func Disassemble(code []byte, addr uint16) string {
+	end := int(addr) + len(code)
+	inCode := func(a uint16) bool {
+		return int(addr) <= int(a) && int(a) < end
+	}
+
+	// pass 1: labels at the instructions in the code
+	starts := make(map[uint16]bool)
+	var targets []uint16
+	for pos := 0; pos < len(code); {
+		in := DisassembleOne(code[pos:], addr+uint16(pos), nil)
+		starts[in.Addr] = true
+		if in.Target >= 0 && inCode(uint16(in.Target)) {
+			targets = append(targets, uint16(in.Target))
+		}
+		pos += len(in.Bytes)
+	}
+	labels := make(map[uint16]bool)
+	for _, t := range targets {
+		if starts[t] {
+			labels[t] = true
+		}
+	}
+	label := func(a uint16) string {
+		if labels[a] {
+			return fmt.Sprintf("L%04X", a)
+		}
+		if !inCode(a) {
+			return BIOSLabels[a]
+		}
+		return ""
+	}
+
+	// pass 2: listing
+	var sb strings.Builder
+	for pos := 0; pos < len(code); {
+		in := DisassembleOne(code[pos:], addr+uint16(pos), label)
+		if labels[in.Addr] {
+			fmt.Fprintf(&sb, "L%04X:\n", in.Addr)
+		}
+		b := make([]string, len(in.Bytes))
+		for i, c := range in.Bytes {
+			b[i] = fmt.Sprintf("%02X", c)
+		}
+		fmt.Fprintf(&sb, "%04X  %-12s  %s\n", in.Addr, strings.Join(b, " "), in.Text)
+		pos += len(in.Bytes)
+	}
+	return sb.String()
+}
@@ -0,0 +1,97 @@
+package msx
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisassembleOne(t *testing.T) {
+	label := func(a uint16) string {
+		return BIOSLabels[a]
+	}
+	tests := []struct {
+		code []byte
+		want string
+	}{
+		// immediates are not labeled
+		{[]byte{0x21, 0x41, 0x00}, "LD HL,0041H"},
+		{[]byte{0x01, 0x38, 0x00}, "LD BC,0038H"},
+		{[]byte{0xdd, 0x21, 0x41, 0x00}, "LD IX,0041H"},
+		// jumps and memory operands are
+		{[]byte{0xcd, 0x41, 0x00}, "CALL DISSCR"},
+		{[]byte{0x3a, 0x41, 0x00}, "LD A,(DISSCR)"},
+	}
+	for _, tt := range tests {
+		got := DisassembleOne(tt.code, 0xc000, label)
+		if got.Text != tt.want {
+			t.Errorf("% x: got %q, want %q", tt.code, got.Text, tt.want)
+		}
+		if len(got.Bytes) != len(tt.code) {
+			t.Errorf("% x: %d bytes", tt.code, len(got.Bytes))
+		}
+	}
+}
+
+func TestDisassembleOneOperands(t *testing.T) {
+	tests := []struct {
+		code   []byte
+		want   string
+		target int
+	}{
+		// DD/FD CB: the displacement comes before the opcode
+		{[]byte{0xdd, 0xcb, 0x05, 0x46}, "BIT 0,(IX+05H)", -1},
+		{[]byte{0xfd, 0xcb, 0xfe, 0xfe}, "SET 7,(IY-02H)", -1},
+		{[]byte{0xdd, 0xcb, 0x10, 0x06}, "RLC (IX+10H)", -1},
+		{[]byte{0xcb, 0x7e}, "BIT 7,(HL)", -1},
+		// negative displacements
+		{[]byte{0xdd, 0x7e, 0xff}, "LD A,(IX-01H)", -1},
+		{[]byte{0xfd, 0x36, 0x80, 0x12}, "LD (IY-80H),12H", -1},
+		{[]byte{0xdd, 0x34, 0x7f}, "INC (IX+7FH)", -1},
+		// IXH and IXL unless (IX+d) is used
+		{[]byte{0xdd, 0x26, 0x12}, "LD IXH,12H", -1},
+		{[]byte{0xdd, 0x65}, "LD IXH,IXL", -1},
+		{[]byte{0xfd, 0x7c}, "LD A,IYH", -1},
+		{[]byte{0xdd, 0x66, 0x03}, "LD H,(IX+03H)", -1},
+		{[]byte{0xdd, 0x75, 0xfd}, "LD (IX-03H),L", -1},
+		{[]byte{0xfd, 0x85}, "ADD A,IYL", -1},
+		// ED block instructions
+		{[]byte{0xed, 0xb0}, "LDIR", -1},
+		{[]byte{0xed, 0xb8}, "LDDR", -1},
+		{[]byte{0xed, 0xb1}, "CPIR", -1},
+		{[]byte{0xed, 0xa3}, "OUTI", -1},
+		{[]byte{0xed, 0xb3}, "OTIR", -1},
+		{[]byte{0xed, 0xaa}, "IND", -1},
+		{[]byte{0xed, 0x00}, "DB 0EDH,00H", -1},
+		// relative jumps from the next instruction
+		{[]byte{0x18, 0xfe}, "JR 0C000H", 0xc000},
+		{[]byte{0x20, 0x10}, "JR NZ,0C012H", 0xc012},
+		{[]byte{0x10, 0xfc}, "DJNZ 0BFFEH", 0xbffe},
+		{[]byte{0x38, 0x7f}, "JR C,0C081H", 0xc081},
+		// cut off at the end of the code
+		{[]byte{0xc3, 0x00}, "DB 0C3H", -1},
+		{[]byte{0x18}, "DB 18H", -1},
+		{[]byte{0xdd}, "DB 0DDH", -1},
+		{[]byte{0xdd, 0xcb, 0x05}, "DB 0DDH", -1},
+		{[]byte{0xed}, "DB 0EDH", -1},
+	}
+	for _, tt := range tests {
+		got := DisassembleOne(tt.code, 0xc000, nil)
+		if got.Text != tt.want || got.Target != tt.target {
+			t.Errorf("% x: got %q %d, want %q %d", tt.code, got.Text, got.Target, tt.want, tt.target)
+		}
+		n := len(tt.code)
+		if strings.HasPrefix(tt.want, "DB ") && !strings.Contains(tt.want, ",") {
+			// only the first byte is data
+			n = 1
+		}
+		if len(got.Bytes) != n {
+			t.Errorf("% x: %d bytes", tt.code, len(got.Bytes))
+		}
+	}
+
+	// a prefix before another prefix is data
+	got := DisassembleOne([]byte{0xdd, 0xfd, 0x21, 0x00, 0x00}, 0xc000, nil)
+	if got.Text != "DB 0DDH" || len(got.Bytes) != 1 {
+		t.Errorf("DD FD: got %q, %d bytes", got.Text, len(got.Bytes))
+	}
+}